@@ -5,14 +5,17 @@ import (
 	"io/ioutil"
 	stdlog "log"
 	"os"
+	"path/filepath"
 	"reflect"
 	"runtime"
+	"strings"
 
 	// Use this package here, as it supports the Prometheus yaml tags for the RuleGroups
 	yaml "gopkg.in/yaml.v2"
 
 	"github.com/alecthomas/kingpin"
 	kitlog "github.com/go-kit/kit/log"
+	"github.com/prometheus/common/model"
 
 	"github.com/gocardless/slo-builder/pkg/templates"
 )
@@ -26,7 +29,12 @@ var (
 
 	build               = app.Command("build", "Builds a Prometheus RuleGroup from given SLO definitions")
 	buildName           = build.Flag("name", "Name of the generated Prometheus RuleGroup").Default("slo-builder").String()
-	buildSloDefinitions = build.Arg("slo-definitions", "Files containing list of SLO template instances").Strings()
+	buildPresets        = build.Flag("presets", "Files containing additional SLI presets").Strings()
+	buildMatchers       = build.Flag("matcher", "Label matcher added to every selector of the SLO definitions, such as cluster=prod-eu").StringMap()
+	buildOverlays       = build.Flag("overlay", "Files containing patches to apply to the SLO definitions, such as overrides for an environment").Strings()
+	buildExclusionRes   = build.Flag("exclusion-resolution", "Window over which rates are measured for SLOs with exclusions, which must span at least two scrapes").Default(templates.ExclusionResolution).String()
+	buildPrintResolved  = build.Flag("print-resolved", "Print the SLO definitions once defaults and overlays have been applied, instead of building rules").Bool()
+	buildSloDefinitions = build.Arg("slo-definitions", "Files, directories or globs containing lists of SLO template instances, or - for stdin").Strings()
 )
 
 func main() {
@@ -41,12 +49,55 @@ func main() {
 		}
 
 	case build.FullCommand():
-		slos, err := loadDefinitions(*buildSloDefinitions)
+		templates.GlobalMatchers = *buildMatchers
+
+		if _, err := model.ParseDuration(*buildExclusionRes); err != nil {
+			logger.Log("error", err, "msg", "invalid exclusion resolution")
+			os.Exit(1)
+		}
+
+		templates.ExclusionResolution = *buildExclusionRes
+
+		if err := loadPresets(*buildPresets); err != nil {
+			logger.Log("error", err, "msg", "failed to load presets from preset files")
+			os.Exit(1)
+		}
+
+		definitions, err := loadDefinitions(*buildSloDefinitions)
 		if err != nil {
 			logger.Log("error", err, "msg", "failed to load slos from definition files")
 			os.Exit(1)
 		}
 
+		definitions, err = applyOverlays(definitions, *buildOverlays)
+		if err != nil {
+			logger.Log("error", err, "msg", "failed to apply overlays to slo definitions")
+			os.Exit(1)
+		}
+
+		if *buildPrintResolved {
+			resolvedYaml, err := templates.MarshalDefinitions(definitions)
+			if err != nil {
+				logger.Log("error", err, "msg", "failed to generate resolved definitions YAML")
+				os.Exit(1)
+			}
+
+			os.Stdout.Write(resolvedYaml)
+			return
+		}
+
+		slos, err := parseDefinitions(definitions)
+		if err != nil {
+			logger.Log("error", err, "msg", "failed to load slos from definition files")
+			os.Exit(1)
+		}
+
+		slos, err = templates.SortByDependencies(slos)
+		if err != nil {
+			logger.Log("error", err, "msg", "failed to resolve dependencies between slos")
+			os.Exit(1)
+		}
+
 		p := templates.NewPipeline(*buildName)
 		for _, slo := range slos {
 			logger.Log("event", "register_slo", "template", reflect.TypeOf(slo), "name", slo.GetName())
@@ -63,27 +114,239 @@ func main() {
 	}
 }
 
-func loadDefinitions(definitionFiles []string) ([]templates.SLO, error) {
-	slos := []templates.SLO{}
-	for _, definitionFile := range definitionFiles {
-		logger := kitlog.With(logger, "file", definitionFile)
-		logger.Log("event", "parse_definitions")
+func loadPresets(presetFiles []string) error {
+	for _, presetFile := range presetFiles {
+		logger := kitlog.With(logger, "file", presetFile)
+		logger.Log("event", "parse_presets")
+
+		presets, err := ioutil.ReadFile(presetFile)
+		if err != nil {
+			return err
+		}
+
+		if err := templates.LoadPresets(presets); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
 
-		definition, err := ioutil.ReadFile(definitionFile)
+// loadDefinitions loads the definitions from each path, which may be a file, a directory
+// that is searched recursively for YAML files, a glob, or - for stdin. Files found in
+// directories and globs are loaded in lexical order, so the generated rules are stable.
+func loadDefinitions(paths []string) ([]templates.Definition, error) {
+	loader := definitionLoader{loaded: map[string]bool{}}
+	definitions := []templates.Definition{}
+	for _, path := range paths {
+		files, err := expandDefinitionPath(path)
 		if err != nil {
 			return nil, err
 		}
 
-		definitionSlos, err := templates.ParseDefinitions(definition)
+		for _, file := range files {
+			fileDefinitions, err := loader.load(file)
+			if err != nil {
+				return nil, err
+			}
+
+			definitions = append(definitions, fileDefinitions...)
+		}
+	}
+
+	return definitions, nil
+}
+
+// definitionLoader loads definition files along with the files they include, such as:
+//
+//	---
+//	include:
+//	  - ../shared/payments.yaml
+//	  - teams/
+//	definitions:
+//	  - ...
+//
+// Includes are resolved relative to the including file, and are loaded before its own
+// definitions. Each file is loaded at most once, however many times it is included.
+type definitionLoader struct {
+	loaded  map[string]bool // absolute paths of the files that have been loaded
+	loading []string        // files currently being loaded, to detect include cycles
+}
+
+func (l *definitionLoader) load(file string) ([]templates.Definition, error) {
+	key := file
+	if file != "-" {
+		abs, err := filepath.Abs(file)
 		if err != nil {
 			return nil, err
 		}
 
-		for _, slo := range definitionSlos {
-			slos = append(slos, slo)
+		key = abs
+	}
+
+	for idx, loading := range l.loading {
+		if loading == key {
+			return nil, fmt.Errorf("include cycle: %s", strings.Join(append(l.loading[idx:], key), " -> "))
 		}
 	}
 
+	if l.loaded[key] {
+		return []templates.Definition{}, nil
+	}
+
+	l.loaded[key] = true
+	l.loading = append(l.loading, key)
+	defer func() { l.loading = l.loading[:len(l.loading)-1] }()
+
+	logger := kitlog.With(logger, "file", file)
+	logger.Log("event", "parse_definitions")
+
+	var payload []byte
+	var err error
+	if file == "-" {
+		payload, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		payload, err = ioutil.ReadFile(file)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	envelope := struct {
+		Include []string `yaml:"include"`
+	}{}
+
+	if err := yaml.Unmarshal(payload, &envelope); err != nil {
+		return nil, fmt.Errorf("%s: %v", file, err)
+	}
+
+	dir := "."
+	if file != "-" {
+		dir = filepath.Dir(file)
+	}
+
+	definitions := []templates.Definition{}
+	for _, include := range envelope.Include {
+		if !filepath.IsAbs(include) {
+			include = filepath.Join(dir, include)
+		}
+
+		files, err := expandDefinitionPath(include)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", file, err)
+		}
+
+		for _, includedFile := range files {
+			includedDefinitions, err := l.load(includedFile)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", file, err)
+			}
+
+			definitions = append(definitions, includedDefinitions...)
+		}
+	}
+
+	fileDefinitions, err := templates.ResolveDefinitions(payload)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", file, err)
+	}
+
+	for idx := range fileDefinitions {
+		fileDefinitions[idx].Source = file
+	}
+
+	return append(definitions, fileDefinitions...), nil
+}
+
+// expandDefinitionPath finds the definition files for a path, searching directories
+// recursively for YAML files and matching globs, in lexical order
+func expandDefinitionPath(path string) ([]string, error) {
+	if path == "-" {
+		return []string{path}, nil
+	}
+
+	matches := []string{path}
+	if strings.ContainsAny(path, "*?[") {
+		var err error
+		matches, err = filepath.Glob(path)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("no files match %s", path)
+		}
+	}
+
+	files := []string{}
+	for _, match := range matches {
+		info, err := os.Stat(match)
+		if err != nil {
+			return nil, err
+		}
+
+		if !info.IsDir() {
+			files = append(files, match)
+			continue
+		}
+
+		err = filepath.Walk(match, func(file string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+
+			if ext := filepath.Ext(file); !info.IsDir() && (ext == ".yaml" || ext == ".yml") {
+				files = append(files, file)
+			}
+
+			return nil
+		})
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return files, nil
+}
+
+func applyOverlays(definitions []templates.Definition, overlayFiles []string) ([]templates.Definition, error) {
+	for _, overlayFile := range overlayFiles {
+		logger := kitlog.With(logger, "file", overlayFile)
+		logger.Log("event", "apply_overlay")
+
+		overlay, err := ioutil.ReadFile(overlayFile)
+		if err != nil {
+			return nil, err
+		}
+
+		definitions, err = templates.ApplyOverlay(definitions, overlay)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", overlayFile, err)
+		}
+	}
+
+	return definitions, nil
+}
+
+func parseDefinitions(definitions []templates.Definition) ([]templates.SLO, error) {
+	sources := map[string]string{}
+	slos := []templates.SLO{}
+	for _, definition := range definitions {
+		slo, err := definition.SLO()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", definition.Source, err)
+		}
+
+		if source, ok := sources[slo.GetName()]; ok {
+			return nil, fmt.Errorf("duplicate SLO name %s, defined in %s and %s", slo.GetName(), source, definition.Source)
+		}
+
+		sources[slo.GetName()] = definition.Source
+		slos = append(slos, slo)
+	}
+
 	return slos, nil
 }
 
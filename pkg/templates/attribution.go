@@ -0,0 +1,129 @@
+package templates
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/prometheus/pkg/rulefmt"
+)
+
+// When an SLO burns its budget, the first question is which release, namespace or handler
+// is responsible. ErrorRateSLOs can declare attribution labels, which break the errors of
+// the SLO down by the value of each label to produce:
+//
+// - job:slo_error_attribution:rate<I>{name, attribution...}, the rate of errors
+// - job:slo_error_attribution:ratio<I>{name, attribution...}, the share of all errors
+// - job:slo_error_attribution_top:ratio<I>{name, attribution..., contributor}, the largest
+//   shares, where the contributor label joins the values of the attribution labels
+//
+// The burn alerts list the top contributors of the SLO in their annotations.
+
+// defaultAttributionTopK is the number of top contributors recorded, unless the
+// definition asks for a different number
+const defaultAttributionTopK = 5
+
+// attribution configures the labels by which the errors of an SLO are broken down
+type attribution struct {
+	By   []string `json:"by"`   // labels whose values are attributed their share of the errors
+	TopK int      `json:"topk"` // number of top contributors to record
+}
+
+// validate checks the attribution labels, and that the errors expression of the SLO can
+// be broken down by them
+func (a attribution) validate(b baseSLO, errors string) error {
+	if len(a.By) == 0 {
+		if a.TopK != 0 {
+			return fmt.Errorf("attribution topk requires attribution labels")
+		}
+
+		return nil
+	}
+
+	if a.TopK < 0 {
+		return fmt.Errorf("attribution topk must not be negative")
+	}
+
+	for _, label := range a.By {
+		for _, dimension := range b.Dimensions {
+			if label == dimension {
+				return fmt.Errorf("attribution label %s is already a dimension", label)
+			}
+		}
+	}
+
+	if _, err := withAttribution(errors, b.Dimensions, a.By); err != nil {
+		return fmt.Errorf("invalid expression %s: %v", errors, err)
+	}
+
+	return nil
+}
+
+func (a attribution) topK() int {
+	if a.TopK == 0 {
+		return defaultAttributionTopK
+	}
+
+	return a.TopK
+}
+
+// definition records the attribution in the labels of job:slo_definition:none
+func (a attribution) definition() map[string]string {
+	if len(a.By) == 0 {
+		return map[string]string{}
+	}
+
+	return map[string]string{
+		"attribution":      strings.Join(a.By, ", "),
+		"attribution_topk": strconv.Itoa(a.topK()),
+	}
+}
+
+// rules generates the attribution rules for the SLO, from the errors expression that is
+// ready for use in a rule, and the recorded job:slo_error_rate_errors:rate<I> series
+func (a attribution) rules(b baseSLO, errors string) []rulefmt.Rule {
+	if len(a.By) == 0 {
+		return []rulefmt.Rule{}
+	}
+
+	attributed, err := withAttribution(errors, b.Dimensions, a.By)
+	if err != nil {
+		panic(fmt.Sprintf("invalid expression %s: %v", errors, err))
+	}
+
+	// Attribute the errors of the same combinations as the errors of the SLO, which fall
+	// back to a single error rate once there are more than maxSeries
+	if b.limited() {
+		attributed = b.limit("sum", attributed, a.By...)
+	}
+
+	by := strings.Join(a.By, ", ")
+	quoted := []string{}
+	for _, label := range a.By {
+		quoted = append(quoted, strconv.Quote(label))
+	}
+
+	return flattenRules(
+		b.forRateIntervals(AlertWindows, rulefmt.Rule{
+			Record: "job:slo_error_attribution:rate%s",
+			Labels: b.joinLabels(),
+			Expr:   attributed,
+		}),
+		forIntervals(AlertWindows, rulefmt.Rule{
+			Record: "job:slo_error_attribution:ratio%s",
+			Labels: b.joinLabels(),
+			Expr: fmt.Sprintf(
+				"job:slo_error_attribution:rate%%[1]s{name=\"%s\"}\n/ ignoring(%s) group_left()\njob:slo_error_rate_errors:rate%%[1]s{name=\"%s\"}",
+				b.Name, by, b.Name,
+			),
+		}),
+		forIntervals(AlertWindows, rulefmt.Rule{
+			Record: "job:slo_error_attribution_top:ratio%s",
+			Labels: b.joinLabels(),
+			Expr: fmt.Sprintf(
+				"label_join(\n  topk without(%s) (%d, job:slo_error_attribution:ratio%%[1]s{name=\"%s\"}),\n  \"contributor\", \", \", %s\n)",
+				by, a.topK(), b.Name, strings.Join(quoted, ", "),
+			),
+		}),
+	)
+}
@@ -0,0 +1,121 @@
+package templates
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/prometheus/prometheus/template"
+)
+
+func TestAttribution(t *testing.T) {
+	slo := mustParseSLO(t, "ErrorRateSLO", `
+name: Requests
+budget: 0.01
+errors: sum(rate(http_requests_total{status="500"}[5m]))
+total: sum(rate(http_requests_total[5m]))
+attribution:
+  by: [handler]
+  topk: 1
+`)
+
+	test := evalSLOs(t, `
+load 1m
+  http_requests_total{handler="search", status="200"} 0+10x10
+  http_requests_total{handler="search", status="500"} 0+3x10
+  http_requests_total{handler="create", status="500"} 0+1x10
+`, 10, slo)
+	defer test.Close()
+
+	test.assertValue(`job:slo_error_attribution:ratio5m{name="Requests", handler="search"}`, minute(10), 0.75)
+	test.assertValue(`job:slo_error_attribution:ratio5m{name="Requests", handler="create"}`, minute(10), 0.25)
+	test.assertValue(`job:slo_error_attribution_top:ratio5m{name="Requests", contributor="search"}`, minute(10), 0.75)
+	test.assertAbsent(`job:slo_error_attribution_top:ratio5m{name="Requests", contributor="create"}`, minute(10))
+}
+
+func TestAttributionMaxSeries(t *testing.T) {
+	slo := mustParseSLO(t, "ErrorRateSLO", `
+name: Requests
+budget: 0.01
+dimensions: [release]
+maxSeries: 1
+errors: rate(http_requests_total{status="500"}[5m])
+total: rate(http_requests_total[5m])
+attribution:
+  by: [handler]
+`)
+
+	test := evalSLOs(t, `
+load 1m
+  http_requests_total{release="a", handler="search", status="500"} 0+3x10
+  http_requests_total{release="b", handler="create", status="500"} 0+1x10
+`, 10, slo)
+	defer test.Close()
+
+	// Beyond the limit, errors are attributed across every release
+	test.assertValue(`job:slo_error_attribution:ratio5m{name="Requests", handler="search"}`, minute(10), 0.75)
+	test.assertValue(`job:slo_error_attribution:ratio5m{name="Requests", handler="create"}`, minute(10), 0.25)
+}
+
+func TestTopContributors(t *testing.T) {
+	slo := mustParseSLO(t, "ErrorRateSLO", `
+name: Requests
+budget: 0.01
+dimensions: [release]
+errors: rate(http_requests_total{status="500"}[5m])
+total: rate(http_requests_total[5m])
+attribution:
+  by: [handler]
+`)
+
+	test := evalSLOs(t, `
+load 1m
+  http_requests_total{release="a", handler="search", status="500"} 0+3x70
+  http_requests_total{release="a", handler="create", status="500"} 0+1x70
+  http_requests_total{release="b", handler="delete", status="500"} 0+1x70
+`, 70, slo)
+	defer test.Close()
+
+	var annotation string
+	for _, rule := range AlertRules {
+		if rule.Alert == "SLOErrorBudgetFastBurn" {
+			annotation = rule.Annotations["top_contributors"]
+		}
+	}
+
+	labels := map[string]string{"name": "Requests", "release": "a", "channel": "payments", "severity": "page"}
+	expander := template.NewTemplateExpander(
+		test.Context(),
+		"{{$labels := .Labels}}"+annotation,
+		"top_contributors",
+		template.AlertTemplateData(labels, nil, 1),
+		model.TimeFromUnixNano(minute(70).UnixNano()),
+		func(_ context.Context, expr string, ts time.Time) (promql.Vector, error) {
+			return test.query(expr, ts), nil
+		},
+		nil,
+	)
+
+	got, err := expander.Expand()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the contributors to the release the alert fired for are listed
+	if expected := "search: 75%\ncreate: 25%\n"; got != expected {
+		t.Errorf("unexpected top contributors\n  got: %q\n  expected: %q", got, expected)
+	}
+}
+
+func TestAttributionValidate(t *testing.T) {
+	parseSLOError(t, "ErrorRateSLO", `
+name: Requests
+budget: 0.01
+errors: max(rate(http_requests_total{status="500"}[5m]))
+total: sum(rate(http_requests_total[5m]))
+attribution:
+  by: [handler]
+`)
+}
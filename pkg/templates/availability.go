@@ -0,0 +1,119 @@
+package templates
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/pkg/rulefmt"
+	"github.com/prometheus/prometheus/promql"
+)
+
+var (
+	// AvailabilityTemplateRules map from the job:slo_probe_* time series to the
+	// SLO-compliant job:slo_error:ratio<I> series that are used to power alerts.
+	AvailabilityTemplateRules = flattenRules(
+		// Use avg_over_time to map job:slo_probe_error:interval into error rate as measured
+		// over the common alert window intervals.
+		forIntervals(AlertWindows,
+			rulefmt.Rule{
+				Record: "job:slo_error:ratio%s",
+				Expr:   `avg_over_time(job:slo_probe_error:interval[%s])`,
+			},
+		),
+	)
+)
+
+func init() {
+	MustRegisterTemplate(AvailabilitySLO{}, AvailabilityTemplateRules...)
+}
+
+// AvailabilitySLO is used to construct SLOs from blackbox probes, for endpoints where we
+// have no better measure of availability than regularly checking them from the outside.
+//
+// To use this template, you provide label matchers that select the probe_success and
+// probe_duration_seconds series produced by the blackbox exporter, such as:
+//
+//	{job="blackbox", instance="https://api.example.com/health"}
+//
+// Every interval in which a probe fails is counted as an error. If you also provide a
+// latency threshold, intervals in which a probe took longer than this are also errors.
+//
+// A probe we can't observe is not a probe that succeeded. Whenever the probe series for a
+// target are missing, such as when the exporter is down and the target's up series is 0,
+// or when no probe series match at all, the interval is counted as an error.
+type AvailabilitySLO struct {
+	baseSLO
+	Probe            string                // label matchers that select the probe series
+	LatencyThreshold serializeableDuration // probes slower than this are errors, optional
+}
+
+func (a AvailabilitySLO) Validate() error {
+	if a.Probe == "" {
+		return fmt.Errorf("probe must be provided")
+	}
+
+	if _, err := promql.ParseMetricSelector(a.selector("probe_success")); err != nil {
+		return fmt.Errorf("invalid probe selector: %v", err)
+	}
+
+	if err := a.validateExprs(a.selector("probe_success")); err != nil {
+		return err
+	}
+
+	return a.validateDimensions("min", a.selector("probe_success"))
+}
+
+func (a AvailabilitySLO) Rules() []rulefmt.Rule {
+	definition := map[string]string{
+		"template": "AvailabilitySLO",
+		"probe":    a.Probe,
+	}
+
+	success := a.series("min", "probe_success")
+	if a.LatencyThreshold > 0 {
+		definition["latency_threshold"] = model.Duration(a.LatencyThreshold).String()
+		success = fmt.Sprintf(
+			"%s * (%s <= bool %s)",
+			success, a.series("max", "probe_duration_seconds"),
+			strconv.FormatFloat(time.Duration(a.LatencyThreshold).Seconds(), 'f', -1, 64),
+		)
+	}
+
+	successSelector := fmt.Sprintf(`job:slo_probe_success:bool{name="%s"}`, a.Name)
+
+	return flattenRules(
+		a.baseSLO.Rules(definition),
+		a.dimensionRules("min", a.mustRender(a.selector("probe_success"))),
+		rulefmt.Rule{
+			Record: "job:slo_probe_duration:seconds",
+			Labels: a.joinLabels(),
+			Expr:   a.series("max", "probe_duration_seconds"),
+		},
+		rulefmt.Rule{
+			Record: "job:slo_probe_success:bool",
+			Labels: a.joinLabels(),
+			Expr:   success,
+		},
+		rulefmt.Rule{
+			Record: "job:slo_probe_error:interval",
+			Labels: a.joinLabels(),
+			Expr: unlessExcluded(fmt.Sprintf(
+				"(1 - %[1]s)\nor\n(0 * %[2]s + 1 unless ignoring(name) %[1]s)\nor\nabsent(%[1]s)",
+				successSelector, a.series("min", "up"),
+			)),
+		},
+	)
+}
+
+// series prepares the probe series of the given metric for use in a rule, aggregated by
+// the dimensions of the SLO with the given operator
+func (a AvailabilitySLO) series(op, metric string) string {
+	return a.mustAggregate(op, a.mustRender(a.selector(metric)))
+}
+
+// selector applies the probe label matchers to the given metric
+func (a AvailabilitySLO) selector(metric string) string {
+	return metric + bracedMatchers(a.Probe)
+}
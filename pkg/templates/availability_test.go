@@ -0,0 +1,51 @@
+package templates
+
+import (
+	"testing"
+)
+
+func TestAvailabilitySLO(t *testing.T) {
+	api := mustParseSLO(t, "AvailabilitySLO", `
+name: API
+budget: 0.01
+probe: '{job="blackbox", instance="https://api"}'
+latencyThreshold: 1s
+`)
+
+	missing := mustParseSLO(t, "AvailabilitySLO", `
+name: Missing
+budget: 0.01
+probe: '{job="blackbox", instance="https://missing"}'
+`)
+
+	test := evalSLOs(t, `
+load 1m
+  probe_success{job="blackbox", instance="https://api"} 1 1 0 1 1
+  probe_duration_seconds{job="blackbox", instance="https://api"} 0.1 0.1 0.1 2 0.1
+  up{job="blackbox", instance="https://api"} 1 1 1 1 1
+`, 4, api, missing)
+	defer test.Close()
+
+	// Failed probes and slow probes are both errors
+	for idx, expected := range []float64{0, 0, 1, 1, 0} {
+		test.assertValue(`job:slo_probe_error:interval{name="API"}`, minute(idx), expected)
+	}
+
+	test.assertValue(`job:slo_error:ratio5m{name="API"}`, minute(4), 0.4)
+
+	// A probe we can't observe at all is an error
+	test.assertValue(`job:slo_probe_error:interval{name="Missing"}`, minute(4), 1)
+}
+
+func TestAvailabilitySLOValidate(t *testing.T) {
+	parseSLOError(t, "AvailabilitySLO", `
+name: API
+budget: 0.01
+`)
+
+	parseSLOError(t, "AvailabilitySLO", `
+name: API
+budget: 0.01
+probe: '{job="blackbox"'
+`)
+}
@@ -2,7 +2,14 @@ package templates
 
 import (
 	"fmt"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/pkg/labels"
 	"github.com/prometheus/prometheus/pkg/rulefmt"
 )
 
@@ -14,6 +21,12 @@ type SLO interface {
 	Rules() []rulefmt.Rule
 }
 
+// validator is implemented by SLOs that need to check their definition is well formed
+// before generating rules. Definitions are validated as soon as they have been parsed.
+type validator interface {
+	Validate() error
+}
+
 // baseSLO is at the core of every SLO. Regardless of which template is used, every SLO
 // must have an associated name and error budget. From this we produce two Prometheus
 // rules:
@@ -31,40 +44,213 @@ type SLO interface {
 // budget can determine when to fire alerts.
 //
 // The `slo_labels_info` provides additional labels that can be useful in the
-// alerting rules.
+// alerting rules. The alerts take their channel and severity from it, so it always
+// has a severity, which is DefaultSeverity unless the labels give one.
+//
+// SLOs with exclusions or a schedule also produce job:slo_exclusion:active{name}, as
+// described in exclusions.go and schedule.go.
 //
 type baseSLO struct {
-	Name   string            `json:"name"`
-	Budget float64           `json:"budget"`
-	Labels map[string]string `json:"labels"`
+	Name       string                `json:"name"`
+	Budget     serializeableRatio    `json:"budget"`
+	Objective  serializeableRatio    `json:"objective"`
+	Labels     map[string]string     `json:"labels"`
+	Matchers   map[string]string     `json:"matchers"`
+	Dimensions []string              `json:"dimensions"`
+	MaxSeries  int                   `json:"maxSeries"`
+	TopK       int                   `json:"topk"`
+	Delay      serializeableDuration `json:"delay"`
+	Exclusions exclusions            `json:"exclusions"`
+	Schedule   schedule              `json:"schedule"`
 }
 
+// GlobalMatchers are added as label matchers to every selector in the expressions of
+// every SLO definition, alongside the matchers of the definition itself. This allows the
+// same definitions to be built for several clusters or environments.
+var GlobalMatchers = map[string]string{}
+
+// DefaultSeverity is the severity of the alerts of SLOs whose labels don't provide one
+var DefaultSeverity = "ticket"
+
 func (b baseSLO) GetName() string {
 	return b.Name
 }
 
 func (b baseSLO) Rules(additionals ...map[string]string) []rulefmt.Rule {
-	return []rulefmt.Rule{
+	definition := map[string]string{
+		"budget": b.budget().String(),
+	}
+
+	if b.Objective.Rat != nil {
+		definition["objective"] = b.Objective.String()
+	}
+
+	if matchers := b.matchers(); len(matchers) > 0 {
+		rendered := []string{}
+		for _, matcher := range matchers {
+			rendered = append(rendered, matcher.String())
+		}
+
+		definition["matchers"] = strings.Join(rendered, ", ")
+	}
+
+	if len(b.Dimensions) > 0 {
+		definition["dimensions"] = strings.Join(b.Dimensions, ", ")
+	}
+
+	if b.MaxSeries > 0 {
+		definition["max_series"] = strconv.Itoa(b.MaxSeries)
+	}
+
+	if b.TopK > 0 {
+		definition["topk"] = strconv.Itoa(b.TopK)
+	}
+
+	if b.Delay > 0 {
+		definition["delay"] = model.Duration(b.Delay).String()
+	}
+
+	for _, modifier := range []map[string]string{b.Exclusions.definition(), b.Schedule.definition()} {
+		for k, v := range modifier {
+			definition[k] = v
+		}
+	}
+
+	return flattenRules(
 		rulefmt.Rule{
 			Record: "job:slo_definition:none",
 			Labels: b.joinLabels(
-				append(additionals, map[string]string{
-					"budget": fmt.Sprintf("%f", b.Budget),
-				})...,
+				append(additionals, definition)...,
 			),
 			Expr: "1",
 		},
 		rulefmt.Rule{
 			Record: "job:slo_error_budget:ratio",
 			Labels: b.joinLabels(),
-			Expr:   fmt.Sprintf("%f", b.Budget),
+			Expr:   b.budget().String(),
 		},
 		rulefmt.Rule{
 			Record: "job:slo_labels_info",
-			Labels: b.joinLabels(b.Labels),
+			Labels: b.joinLabels(map[string]string{"severity": DefaultSeverity}, b.Labels),
 			Expr:   "1",
 		},
+		b.scheduleRules(),
+		b.exclusionRules(),
+	)
+}
+
+// validateBase checks the parts of the definition common to every template
+func (b baseSLO) validateBase() error {
+	if (b.Budget.Rat == nil) == (b.Objective.Rat == nil) {
+		return fmt.Errorf("exactly one of budget or objective must be provided")
+	}
+
+	if budget := b.budget(); budget.Sign() <= 0 || budget.Cmp(big.NewRat(1, 1)) >= 0 {
+		if b.Objective.Rat != nil {
+			return fmt.Errorf("objective must be between 0 and 1 exclusive, but was %s", b.Objective)
+		}
+
+		return fmt.Errorf("budget must be between 0 and 1 exclusive, but was %s", budget)
+	}
+
+	if (b.MaxSeries > 0 || b.TopK > 0) && len(b.Dimensions) == 0 {
+		return fmt.Errorf("maxSeries and topk require dimensions")
+	}
+
+	if b.MaxSeries < 0 || b.TopK < 0 {
+		return fmt.Errorf("maxSeries and topk must not be negative")
+	}
+
+	if b.Delay < 0 {
+		return fmt.Errorf("delay must not be negative")
 	}
+
+	if err := b.Exclusions.validate(); err != nil {
+		return err
+	}
+
+	return b.Schedule.validate()
+}
+
+// budget is the error budget of the SLO, which definitions provide either directly or as
+// the objective that the budget is the remainder of
+func (b baseSLO) budget() serializeableRatio {
+	if b.Objective.Rat != nil {
+		return serializeableRatio{new(big.Rat).Sub(big.NewRat(1, 1), b.Objective.Rat)}
+	}
+
+	return b.Budget
+}
+
+// render prepares an expression provided in the SLO definition for use in a rule, adding
+// the global and definition matchers to every selector and shifting it by the delay of
+// the SLO. Expressions may still be parameterized, and are returned as they are if there
+// is nothing to change.
+func (b baseSLO) render(expr string) (string, error) {
+	matchers := b.matchers()
+	if expr == "" {
+		return expr, nil
+	}
+
+	var err error
+	if len(matchers) > 0 {
+		if expr, err = withMatchers(expr, matchers...); err != nil {
+			return "", err
+		}
+	}
+
+	if b.Delay > 0 {
+		return withOffset(expr, time.Duration(b.Delay))
+	}
+
+	return expr, nil
+}
+
+// mustRender is render for use when generating rules, where expressions have already
+// been checked with validateExprs
+func (b baseSLO) mustRender(expr string) string {
+	rendered, err := b.render(expr)
+	if err != nil {
+		panic(fmt.Sprintf("invalid expression %s: %v", expr, err))
+	}
+
+	return rendered
+}
+
+// validateExprs checks that each expression of the SLO definition can be rendered
+func (b baseSLO) validateExprs(exprs ...string) error {
+	for _, expr := range exprs {
+		if _, err := b.render(expr); err != nil {
+			return fmt.Errorf("invalid expression %s: %v", expr, err)
+		}
+	}
+
+	return nil
+}
+
+// matchers combines the global and definition matchers, in a stable order. Definition
+// matchers take precedence over global matchers on the same label.
+func (b baseSLO) matchers() []*labels.Matcher {
+	combined := map[string]string{}
+	for _, source := range []map[string]string{GlobalMatchers, b.Matchers} {
+		for name, value := range source {
+			combined[name] = value
+		}
+	}
+
+	names := []string{}
+	for name := range combined {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	matchers := []*labels.Matcher{}
+	for _, name := range names {
+		matchers = append(matchers, equalMatcher(name, combined[name]))
+	}
+
+	return matchers
 }
 
 // joinLabels allows templates to pass their additional labels into the definition rule
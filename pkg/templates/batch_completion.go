@@ -0,0 +1,181 @@
+package templates
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/pkg/rulefmt"
+)
+
+var (
+	// BatchCompletionTemplateRules map from the job:slo_batch_run_* time series to the
+	// SLO-compliant job:slo_error:ratio<I> series that are used to power alerts.
+	BatchCompletionTemplateRules = flattenRules(
+		// How long the last run took, or how long the current run has been going if it
+		// has yet to complete.
+		rulefmt.Rule{
+			Record: "job:slo_batch_run_duration:seconds",
+			Expr: `
+(job:slo_batch_run_completed:timestamp - job:slo_batch_run_started:timestamp >= 0)
+or
+(time() - job:slo_batch_run_started:timestamp)
+			`,
+		},
+		// How long the last completed run took, from its own start and completion
+		// timestamps. Once the next run starts we no longer know when the completed run
+		// started, so the duration is held at its last value until the next completion.
+		rulefmt.Rule{
+			Record: "job:slo_batch_run_completed_duration:seconds",
+			Expr: `
+(job:slo_batch_run_completed:timestamp - job:slo_batch_run_started:timestamp >= 0)
+or
+job:slo_batch_run_completed_duration:seconds
+			`,
+		},
+		// How far past the deadline the last completed run finished.
+		rulefmt.Rule{
+			Record: "job:slo_batch_run_lateness:seconds",
+			Expr: `
+clamp_min(
+  job:slo_batch_run_completed_duration:seconds
+    - on(name) group_left() job:slo_batch_run_deadline:seconds,
+  0
+)
+			`,
+		},
+		// Whether the last run finished, or the current run has got, past the deadline.
+		rulefmt.Rule{
+			Record: "job:slo_batch_run_late:bool",
+			Expr: `
+job:slo_batch_run_duration:seconds
+  > bool on(name) group_left() job:slo_batch_run_deadline:seconds
+			`,
+		},
+		// A run that is still going after its deadline is already late, and we shouldn't
+		// wait for it to finish before counting it against the budget.
+		rulefmt.Rule{
+			Record: "job:slo_batch_run_overdue:bool",
+			Expr: `
+(
+  job:slo_batch_run_late:bool
+    * (job:slo_batch_run_started:timestamp > bool job:slo_batch_run_completed:timestamp)
+)
+or
+job:slo_batch_run_late:bool
+			`,
+		},
+		// Takes the completion timestamp while the last run is finished and was late, and
+		// 0 otherwise. Every late run therefore adds exactly one increase to this series,
+		// while the drop back to 0 when the next run starts is counted as a reset.
+		rulefmt.Rule{
+			Record: "job:slo_batch_run_late_completion:timestamp",
+			Expr: `
+job:slo_batch_run_completed:timestamp
+  * (job:slo_batch_run_late:bool - job:slo_batch_run_overdue:bool)
+			`,
+		},
+		// Fraction of runs that completed in each window which missed their deadline,
+		// including any run that is currently overdue.
+		forIntervals(AlertWindows,
+			rulefmt.Rule{
+				Record: "job:slo_error:ratio%s",
+				Expr: `
+(
+  (
+    changes(job:slo_batch_run_late_completion:timestamp[%[1]s])
+      - resets(job:slo_batch_run_late_completion:timestamp[%[1]s])
+    or 0 * job:slo_batch_run_overdue:bool
+  )
+  + job:slo_batch_run_overdue:bool
+)
+/
+(
+  (changes(job:slo_batch_run_completed:timestamp[%[1]s]) or 0 * job:slo_batch_run_overdue:bool)
+  + job:slo_batch_run_overdue:bool
+)
+				`,
+			},
+		),
+	)
+)
+
+func init() {
+	MustRegisterTemplate(BatchCompletionSLO{}, BatchCompletionTemplateRules...)
+}
+
+// BatchCompletionSLO is used to construct SLOs around batch processes where the only
+// thing the business cares about is whether each run finished within a deadline of
+// starting, such as submitting a file to a bank.
+//
+// To use this template, you provide expressions for the unix timestamp that the most
+// recent run started and the timestamp that the most recent run completed. These are
+// often exported by the job itself into a pushgateway, or by a job exporter such as
+// kube-state-metrics. A run is considered in progress whenever the start timestamp is
+// more recent than the completion timestamp.
+//
+// The important characteristics of this SLO are:
+//
+// - Error budget is consumed per run, where each run either met its deadline or didn't
+// - A run that exceeds its deadline is counted as late immediately, not once it finishes
+// - How late the last completed run was is recorded in job:slo_batch_run_lateness:seconds,
+//   and doesn't change when the next run starts
+//
+// Windows in which no runs completed and no run is overdue have no defined error ratio,
+// as there is nothing to measure. For the same reason, exclusions and schedules aren't
+// supported: a run that was late is late, whenever it happened.
+type BatchCompletionSLO struct {
+	baseSLO
+	Deadline  serializeableDuration // time after starting a run that it must complete
+	Started   string                // unix timestamp the most recent run started
+	Completed string                // unix timestamp the most recent run completed
+}
+
+func (b BatchCompletionSLO) Validate() error {
+	if b.Started == "" || b.Completed == "" {
+		return fmt.Errorf("started and completed must be provided")
+	}
+
+	if b.Deadline <= 0 {
+		return fmt.Errorf("deadline must be a positive duration")
+	}
+
+	if b.excluded() {
+		return fmt.Errorf("exclusions and schedules aren't supported, as budget is consumed per run rather than over time")
+	}
+
+	if err := b.validateExprs(b.Started, b.Completed); err != nil {
+		return err
+	}
+
+	return b.validateDimensions("max", b.Started, b.Completed)
+}
+
+func (b BatchCompletionSLO) Rules() []rulefmt.Rule {
+	return flattenRules(
+		b.baseSLO.Rules(
+			map[string]string{
+				"template":  "BatchCompletionSLO",
+				"deadline":  model.Duration(b.Deadline).String(),
+				"started":   b.Started,
+				"completed": b.Completed,
+			},
+		),
+		b.dimensionRules("max", b.mustRender(b.Started)),
+		rulefmt.Rule{
+			Record: "job:slo_batch_run_started:timestamp",
+			Labels: b.joinLabels(),
+			Expr:   b.mustAggregate("max", b.mustRender(b.Started)),
+		},
+		rulefmt.Rule{
+			Record: "job:slo_batch_run_completed:timestamp",
+			Labels: b.joinLabels(),
+			Expr:   b.mustAggregate("max", b.mustRender(b.Completed)),
+		},
+		rulefmt.Rule{
+			Record: "job:slo_batch_run_deadline:seconds",
+			Labels: b.joinLabels(),
+			Expr:   fmt.Sprintf("%d", time.Duration(b.Deadline)/time.Second),
+		},
+	)
+}
@@ -0,0 +1,54 @@
+package templates
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestBatchCompletionSLO(t *testing.T) {
+	slo := mustParseSLO(t, "BatchCompletionSLO", `
+name: Submission
+budget: 0.05
+deadline: 2m
+started: max(submission_last_started_timestamp_seconds)
+completed: max(submission_last_completed_timestamp_seconds)
+`)
+
+	// The first run starts at 0s and completes 3m late at 300s, then the next run starts
+	// at 420s and completes within its deadline at 480s
+	test := evalSLOs(t, `
+load 1m
+  submission_last_started_timestamp_seconds 0 0 0 0 0 0 0 420 420 420
+  submission_last_completed_timestamp_seconds -60 -60 -60 -60 -60 300 300 300 480 480
+`, 9, slo)
+	defer test.Close()
+
+	test.assertAbsent(`job:slo_batch_run_lateness:seconds{name="Submission"}`, minute(4))
+	test.assertValue(`job:slo_batch_run_overdue:bool{name="Submission"}`, minute(4), 1)
+	test.assertValue(`job:slo_batch_run_lateness:seconds{name="Submission"}`, minute(5), 180)
+	test.assertValue(`job:slo_batch_run_overdue:bool{name="Submission"}`, minute(5), 0)
+
+	// Starting the next run mustn't reset the lateness of the completed run
+	test.assertValue(`job:slo_batch_run_lateness:seconds{name="Submission"}`, minute(7), 180)
+	test.assertValue(`job:slo_batch_run_lateness:seconds{name="Submission"}`, minute(8), 0)
+
+	// One of the two runs that completed in the window was late
+	test.assertValue(`job:slo_error:ratio5m{name="Submission"}`, minute(8), 0.5)
+}
+
+func TestBatchCompletionSLOValidate(t *testing.T) {
+	for _, tc := range []struct {
+		definition string
+		err        string
+	}{
+		{"deadline: 2m\ncompleted: max(submission_last_completed_timestamp_seconds)", "started and completed must be provided"},
+		{"deadline: 2m\nstarted: max(submission_last_started_timestamp_seconds)", "started and completed must be provided"},
+		{"started: max(submission_last_started_timestamp_seconds)\ncompleted: max(submission_last_completed_timestamp_seconds)", "deadline must be a positive duration"},
+		{"deadline: 0s\nstarted: max(submission_last_started_timestamp_seconds)\ncompleted: max(submission_last_completed_timestamp_seconds)", "deadline must be a positive duration"},
+	} {
+		err := parseSLOError(t, "BatchCompletionSLO", "name: Submission\nbudget: 0.05\n"+tc.definition)
+		if !strings.Contains(err.Error(), tc.err) {
+			t.Errorf("expected error containing %q, got %v", tc.err, err)
+		}
+	}
+}
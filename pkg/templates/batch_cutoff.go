@@ -0,0 +1,151 @@
+package templates
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/prometheus/prometheus/pkg/rulefmt"
+)
+
+var (
+	// BatchCutoffTemplateRules map from the job:slo_batch_cutoff_* time series to the
+	// SLO-compliant job:slo_error:ratio<I> series that are used to power alerts.
+	BatchCutoffTemplateRules = flattenRules(
+		// The throughput we need to sustain to process the remaining volume before the
+		// cutoff. This is only present while there is work remaining before the cutoff on a
+		// scheduled day.
+		rulefmt.Rule{
+			Record: "job:slo_batch_cutoff_throughput_target:rate",
+			Expr: `
+job:slo_batch_cutoff_remaining:count
+  / on(name) group_left() (job:slo_batch_cutoff_time_left:seconds > 0)
+> 0
+			`,
+		},
+		// Score each interval by the percentage of target throughput we failed to achieve,
+		// where a job that isn't running at all is failing completely. Any work still
+		// remaining once the cutoff has passed is a total failure until the end of the day.
+		rulefmt.Rule{
+			Record: "job:slo_batch_cutoff_error:interval",
+			Expr: unlessExcluded(`
+(
+  1.0 - clamp_max(
+    (job:slo_batch_cutoff_throughput:interval or 0 * job:slo_batch_cutoff_throughput_target:rate)
+      / job:slo_batch_cutoff_throughput_target:rate,
+    1.0
+  )
+)
+or
+(
+  0 * job:slo_batch_cutoff_remaining:count + 1
+    and job:slo_batch_cutoff_remaining:count > 0
+    and on(name) job:slo_batch_cutoff_time_left:seconds <= 0
+)
+			`),
+		},
+		// Use avg_over_time to map job:slo_batch_cutoff_error:interval into error rate as
+		// measured over the common alert window intervals.
+		forIntervals(AlertWindows,
+			rulefmt.Rule{
+				Record: "job:slo_error:ratio%s",
+				Expr:   `avg_over_time(job:slo_batch_cutoff_error:interval[%s])`,
+			},
+		),
+	)
+)
+
+func init() {
+	MustRegisterTemplate(BatchCutoffSLO{}, BatchCutoffTemplateRules...)
+}
+
+// BatchCutoffSLO is used to construct SLOs around batch processes that must be finished
+// by a wall-clock cutoff, such as submitting payments before a bank's 15:30 deadline on
+// business days, rather than within a duration of starting.
+//
+// To use this template, you provide a measure of the volume of work still remaining and a
+// measure of throughput. Whenever there is work remaining on a scheduled day, the SLO
+// computes the throughput required to finish it before the cutoff and scores each
+// interval by how well the job meets that target, just like BatchProcessingSLO.
+//
+// The cutoff is interpreted in the given timezone, accounting for daylight saving, and
+// only applies on the given weekdays (Monday to Friday, unless otherwise specified). Work
+// that remains once the cutoff has passed consumes error budget until the end of the day.
+//
+// The important characteristics of this SLO are:
+//
+// - Error budget is only consumed on scheduled days, while work is remaining
+// - The target becomes more demanding as the cutoff approaches, as there is less time left
+// - A job that isn't running while work remains burns budget at the maximum rate
+type BatchCutoffSLO struct {
+	baseSLO
+	Cutoff     serializeableTimeOfDay // local time of day by which all work must be finished
+	Timezone   serializeableLocation  // timezone of the cutoff, such as Europe/London
+	Weekdays   []serializeableWeekday // days the cutoff applies, defaulting to Monday to Friday
+	Remaining  string                 // volume of work still to be processed
+	Throughput string                 // measure of batch throughput
+}
+
+func (b BatchCutoffSLO) Validate() error {
+	if b.Cutoff <= 0 {
+		return fmt.Errorf("cutoff must be a time of day after 00:00, such as 15:30")
+	}
+
+	if b.Remaining == "" || b.Throughput == "" {
+		return fmt.Errorf("remaining and throughput must be provided")
+	}
+
+	if err := b.validateExprs(b.Remaining, b.Throughput); err != nil {
+		return err
+	}
+
+	return b.validateDimensions("sum", b.Remaining, b.Throughput)
+}
+
+func (b BatchCutoffSLO) Rules() []rulefmt.Rule {
+	localTimeSelector := fmt.Sprintf(`job:slo_batch_cutoff_local_time:timestamp{name="%s"}`, b.Name)
+
+	return flattenRules(
+		b.baseSLO.Rules(
+			map[string]string{
+				"template":   "BatchCutoffSLO",
+				"cutoff":     b.Cutoff.String(),
+				"timezone":   b.Timezone.location().String(),
+				"weekdays":   weekdayNames(b.weekdays()),
+				"remaining":  b.Remaining,
+				"throughput": b.Throughput,
+			},
+		),
+		rulefmt.Rule{
+			Record: "job:slo_batch_cutoff_local_time:timestamp",
+			Labels: b.joinLabels(),
+			Expr:   localTime(b.Timezone.location(), time.Duration(b.Delay)),
+		},
+		rulefmt.Rule{
+			Record: "job:slo_batch_cutoff_time_left:seconds",
+			Labels: b.joinLabels(),
+			Expr: fmt.Sprintf(
+				"(%d - (3600 * hour(%[2]s) + 60 * minute(%[2]s))) and (%s)",
+				time.Duration(b.Cutoff)/time.Second, localTimeSelector, onWeekdays(localTimeSelector, b.weekdays()),
+			),
+		},
+		b.dimensionRules("sum", b.mustRender(b.Remaining)),
+		rulefmt.Rule{
+			Record: "job:slo_batch_cutoff_remaining:count",
+			Labels: b.joinLabels(),
+			Expr:   b.mustAggregate("sum", b.mustRender(b.Remaining)),
+		},
+		rulefmt.Rule{
+			Record: "job:slo_batch_cutoff_throughput:interval",
+			Labels: b.joinLabels(),
+			Expr:   b.mustAggregate("sum", b.mustRender(b.Throughput)),
+		},
+	)
+}
+
+func (b BatchCutoffSLO) weekdays() []serializeableWeekday {
+	if len(b.Weekdays) == 0 {
+		return businessDays
+	}
+
+	return b.Weekdays
+}
@@ -0,0 +1,82 @@
+package templates
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBatchCutoffSLOTimeLeft(t *testing.T) {
+	defer withTimezoneTransitions(
+		time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC),
+		time.Date(2021, time.January, 1, 0, 0, 0, 0, time.UTC),
+	)()
+
+	slo := mustParseSLO(t, "BatchCutoffSLO", `
+name: Submission
+budget: 0.05
+cutoff: "15:30"
+timezone: Europe/London
+remaining: sum(pending_payments)
+throughput: sum(rate(processed_payments_total[1m]))
+`)
+
+	for _, tc := range []struct {
+		name     string
+		ts       time.Time
+		expected float64
+		absent   bool
+	}{
+		// London moves from GMT to BST at 01:00 UTC on Sunday 29 March 2020
+		{name: "friday before march transition", ts: time.Date(2020, time.March, 27, 14, 30, 0, 0, time.UTC), expected: 3600},
+		{name: "weekend of march transition", ts: time.Date(2020, time.March, 29, 14, 30, 0, 0, time.UTC), absent: true},
+		{name: "monday local midnight in BST", ts: time.Date(2020, time.March, 29, 23, 30, 0, 0, time.UTC), expected: 54000},
+		{name: "monday after march transition", ts: time.Date(2020, time.March, 30, 13, 30, 0, 0, time.UTC), expected: 3600},
+		{name: "monday cutoff in BST", ts: time.Date(2020, time.March, 30, 14, 30, 0, 0, time.UTC), expected: 0},
+
+		// London moves from BST to GMT at 01:00 UTC on Sunday 25 October 2020
+		{name: "friday before october transition", ts: time.Date(2020, time.October, 23, 13, 30, 0, 0, time.UTC), expected: 3600},
+		{name: "friday cutoff in BST", ts: time.Date(2020, time.October, 23, 14, 30, 0, 0, time.UTC), expected: 0},
+		{name: "saturday local midnight in BST", ts: time.Date(2020, time.October, 23, 23, 30, 0, 0, time.UTC), absent: true},
+		{name: "weekend of october transition", ts: time.Date(2020, time.October, 25, 14, 30, 0, 0, time.UTC), absent: true},
+		{name: "monday after october transition", ts: time.Date(2020, time.October, 26, 14, 30, 0, 0, time.UTC), expected: 3600},
+		{name: "monday past cutoff in GMT", ts: time.Date(2020, time.October, 26, 16, 30, 0, 0, time.UTC), expected: -3600},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			test := evalAt(t, slo.Rules(), tc.ts)
+			defer test.Close()
+
+			if tc.absent {
+				test.assertAbsent(`job:slo_batch_cutoff_time_left:seconds{name="Submission"}`, tc.ts)
+			} else {
+				test.assertValue(`job:slo_batch_cutoff_time_left:seconds{name="Submission"}`, tc.ts, tc.expected)
+			}
+		})
+	}
+}
+
+func TestBatchCutoffSLOValidate(t *testing.T) {
+	for _, cutoff := range []string{"", `cutoff: "00:00"`} {
+		parseSLOError(t, "BatchCutoffSLO", `
+name: Submission
+budget: 0.05
+`+cutoff+`
+remaining: sum(pending_payments)
+throughput: sum(rate(processed_payments_total[1m]))
+`)
+	}
+
+	for _, exprs := range []string{
+		"remaining: sum(pending_payments)",
+		"throughput: sum(rate(processed_payments_total[1m]))",
+	} {
+		err := parseSLOError(t, "BatchCutoffSLO", `
+name: Submission
+budget: 0.05
+cutoff: "15:30"
+`+exprs)
+		if !strings.Contains(err.Error(), "remaining and throughput must be provided") {
+			t.Errorf("expected missing expression error, got %v", err)
+		}
+	}
+}
@@ -1,7 +1,10 @@
 package templates
 
 import (
+	"encoding/json"
 	"fmt"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/prometheus/common/model"
@@ -14,22 +17,47 @@ var (
 	// alerts.
 	BatchProcessingTemplateRules = flattenRules(
 		// Calculate synthentic 'error score' for the batch as the percentage of target
-		// throughput we failed to achieve over the user defined interval.
+		// throughput we failed to achieve over the user defined interval. Unless the SLO
+		// recoups, throughput above the target scores 0 rather than a negative error. Idle
+		// intervals have no throughput, so are excluded unless the SLO counts them as good.
+		//
+		// Throughput of SLOs that recoup is labelled with the run it belongs to, so that
+		// only intervals of the same run can offset each other.
 		rulefmt.Rule{
 			Record: "job:slo_batch_error:interval",
-			Expr: `
-1.0 - clamp_max(
-  job:slo_batch_throughput:interval / job:slo_batch_throughput_target:max,
-  1.0
+			Expr: unlessExcluded(`
+(
+  1.0 - clamp_max(
+    job:slo_batch_throughput:interval / job:slo_batch_throughput_target:max,
+    1.0
+  )
+  unless on(name) job:slo_batch_scoring:none{recoup="true"}
 )
-			`,
+or
+(
+  1.0 - job:slo_batch_throughput:interval / ignoring(run) group_left() job:slo_batch_throughput_target:max
+  and on(name) job:slo_batch_scoring:none{recoup="true"}
+)
+or
+(
+  0 * job:slo_batch_throughput_target:max
+  and on(name) job:slo_batch_scoring:none{idle="good"}
+  unless ignoring(run) job:slo_batch_throughput:interval
+)
+			`),
 		},
-		// Use avg_over_time to map job:slo_batch_error:interval into error rate as measured
-		// over the common alert window intervals.
+		// Map job:slo_batch_error:interval into error rate as measured over the common
+		// alert window intervals, which is the average error of every interval. Recouped
+		// budget can only offset errors of the same run within the window, and never
+		// produces a negative error for a run.
 		forIntervals(AlertWindows,
 			rulefmt.Rule{
 				Record: "job:slo_error:ratio%s",
-				Expr:   `avg_over_time(job:slo_batch_error:interval[%s])`,
+				Expr: `
+sum without(run) (clamp_min(sum_over_time(job:slo_batch_error:interval[%[1]s]), 0))
+/
+sum without(run) (count_over_time(job:slo_batch_error:interval[%[1]s]))
+				`,
 			},
 		),
 	)
@@ -51,37 +79,104 @@ func init() {
 // historic maximums and applying a growth multiplier that is appropriate for the business
 // context. If you're processing a number of payments, and your peak volume comes once a
 // month, expecting 1.5x the maximum volume processed by the batch job in the last 60 days
-// might be a good starting point.
+// might be a good starting point. Rather than writing this by hand, you can provide a
+// volumeEstimate and have the volume expression generated for you, while volume remains
+// available for anything the estimate can't express.
 //
 // The important characteristics of this SLO are:
 //
 // - Error budget is consumed at a rate proportional to unmet target performance
 // - Error budget is consumed even by batches that process less-than-maximum volume
 //
-// One thing to note is that throughput exceeding the target threshold is considered 0%
-// error, rather than some negative error value. This is a deliberate choice to avoid
-// encouraging spiky throughput values, but may be toggled in future.
+// By default, throughput exceeding the target threshold is considered 0% error, rather
+// than some negative error value. This is a deliberate choice to avoid encouraging spiky
+// throughput values, but setting recoup allows minutes that exceed the target to offset
+// minutes that fell short of it. The throughput must then be labelled with the run it
+// belongs to, given by run, so that one run can't recoup the budget lost by another.
+//
+// Intervals where the job isn't running have no throughput, and by default are excluded
+// from the error rate entirely. Setting idle to good instead scores them as 0% error,
+// which is appropriate when being idle means there is no work left to do.
 type BatchProcessingSLO struct {
 	baseSLO
-	Deadline   serializeableDuration // time after starting the batch that it must finish
-	Volume     string                // expected maximum volume to be processed by a single batch run
-	Throughput string                // measure of batch throughput
+	Deadline       serializeableDuration // time after starting the batch that it must finish
+	Volume         string                // expected maximum volume to be processed by a single batch run
+	VolumeEstimate *volumeEstimate       // generates the volume from historic runs, instead of Volume
+	Throughput     string                // measure of batch throughput
+	Recoup         bool                  // whether throughput above the target can offset errors
+	Run            string                // label of the throughput identifying each run, required to recoup
+	Idle           idlePolicy            // how to score intervals where the job isn't running
+}
+
+func (b BatchProcessingSLO) Validate() error {
+	if (b.Volume == "") == (b.VolumeEstimate == nil) {
+		return fmt.Errorf("exactly one of volume or volumeEstimate must be provided")
+	}
+
+	if b.Throughput == "" {
+		return fmt.Errorf("throughput must be provided")
+	}
+
+	if b.Deadline <= 0 {
+		return fmt.Errorf("deadline must be a positive duration")
+	}
+
+	if b.VolumeEstimate != nil {
+		if err := b.VolumeEstimate.validate(); err != nil {
+			return err
+		}
+	}
+
+	if b.Recoup && b.Run == "" {
+		return fmt.Errorf("recoup requires run, the label of the throughput identifying each batch run")
+	}
+
+	if !b.Recoup && b.Run != "" {
+		return fmt.Errorf("run is only used to recoup, so requires recoup")
+	}
+
+	if err := b.validateExprs(b.volume(), b.Throughput); err != nil {
+		return err
+	}
+
+	if err := b.validateDimensions("sum", b.volume()); err != nil {
+		return err
+	}
+
+	if _, err := b.throughput(); err != nil {
+		return fmt.Errorf("invalid expression %s: %v", b.Throughput, err)
+	}
+
+	return nil
 }
 
 func (b BatchProcessingSLO) Rules() []rulefmt.Rule {
-	return append(
+	return flattenRules(
 		b.baseSLO.Rules(
 			map[string]string{
 				"template":   "BatchProcessingSLO",
 				"deadline":   model.Duration(b.Deadline).String(),
-				"volume":     b.Volume,
+				"volume":     b.volume(),
 				"throughput": b.Throughput,
+				"recoup":     strconv.FormatBool(b.Recoup),
+				"idle":       b.Idle.String(),
 			},
 		),
+		rulefmt.Rule{
+			Record: "job:slo_batch_scoring:none",
+			Labels: b.joinLabels(
+				map[string]string{
+					"recoup": strconv.FormatBool(b.Recoup),
+					"idle":   b.Idle.String(),
+				},
+			),
+			Expr: "1",
+		},
+		b.dimensionRules("sum", b.mustRender(b.volume())),
 		rulefmt.Rule{
 			Record: "job:slo_batch_volume:max",
 			Labels: b.joinLabels(),
-			Expr:   b.Volume,
+			Expr:   b.mustAggregate("sum", b.mustRender(b.volume())),
 		},
 		rulefmt.Rule{
 			Record: "job:slo_batch_throughput_target:max",
@@ -93,7 +188,155 @@ func (b BatchProcessingSLO) Rules() []rulefmt.Rule {
 		rulefmt.Rule{
 			Record: "job:slo_batch_throughput:interval",
 			Labels: b.joinLabels(),
-			Expr:   b.Throughput,
+			Expr:   b.mustThroughput(),
 		},
 	)
 }
+
+// throughput aggregates the throughput by the dimensions. SLOs that recoup also keep the
+// run label, renamed to run so the template rules can match it whatever it was called.
+func (b BatchProcessingSLO) throughput() (string, error) {
+	if !b.Recoup {
+		return b.aggregate("sum", b.mustRender(b.Throughput))
+	}
+
+	perRun, err := withDimensions("sum", b.mustRender(b.Throughput), append(append([]string{}, b.Dimensions...), b.Run))
+	if err != nil {
+		return "", err
+	}
+
+	expr := fmt.Sprintf(
+		"sum by (%s) (\n  label_replace(%s, \"run\", \"$1\", \"%s\", \"(.*)\")\n)",
+		strings.Join(append(append([]string{}, b.Dimensions...), "run"), ", "), strings.TrimSpace(perRun), b.Run,
+	)
+
+	if b.limited() {
+		expr = b.limit("sum", expr, "run")
+	}
+
+	return expr, nil
+}
+
+func (b BatchProcessingSLO) mustThroughput() string {
+	expr, err := b.throughput()
+	if err != nil {
+		panic(fmt.Sprintf("invalid expression %s: %v", b.Throughput, err))
+	}
+
+	return expr
+}
+
+func (b BatchProcessingSLO) volume() string {
+	if b.VolumeEstimate != nil {
+		estimate := *b.VolumeEstimate
+		if len(estimate.By) == 0 {
+			estimate.By = b.Dimensions
+		}
+
+		return estimate.expr()
+	}
+
+	return b.Volume
+}
+
+// volumeEstimate generates the expected maximum volume of a batch run from a counter of
+// processed items, by finding the largest increase of the counter over the length of a
+// single run within the history window, then applying a growth multiplier:
+//
+//	max by (namespace, release) (
+//	  1.5 * max_over_time(
+//	    (
+//	      sum by (namespace, release) (
+//	        increase(paysvc_mark_payments_as_paid_marked_as_paid_total[8h])
+//	      )
+//	    )[60d:1h]
+//	  )
+//	)
+//
+// The grouping labels should match those of the batch throughput, and default to the
+// dimensions of the SLO.
+type volumeEstimate struct {
+	Counter  string                // counter incremented for each item processed by the batch
+	By       []string              // labels to group the volume by
+	Lookback serializeableDuration // time in which a single batch run processes all its items
+	History  serializeableDuration // how far back to look for the largest batch run
+	Growth   float64               // multiplier applied to the largest run, defaulting to 1
+}
+
+// volumeEstimateResolution is the step of the subquery that searches the history for the
+// largest batch run
+var volumeEstimateResolution = model.Duration(time.Hour)
+
+func (v volumeEstimate) validate() error {
+	if v.Counter == "" {
+		return fmt.Errorf("volumeEstimate requires a counter")
+	}
+
+	if v.Lookback <= 0 || v.History <= 0 {
+		return fmt.Errorf("volumeEstimate requires a positive lookback and history")
+	}
+
+	if v.Growth < 0 {
+		return fmt.Errorf("volumeEstimate growth must not be negative")
+	}
+
+	return nil
+}
+
+func (v volumeEstimate) expr() string {
+	growth := v.Growth
+	if growth == 0 {
+		growth = 1.0
+	}
+
+	estimate := fmt.Sprintf(
+		`%s * max_over_time(
+  (
+    %s
+  )[%s:%s]
+)`,
+		strconv.FormatFloat(growth, 'f', -1, 64),
+		aggregateBy("sum", v.By, fmt.Sprintf("\n      increase(%s[%s])\n    ", v.Counter, model.Duration(v.Lookback))),
+		model.Duration(v.History), volumeEstimateResolution,
+	)
+
+	if len(v.By) == 0 {
+		return estimate
+	}
+
+	// Aggregating by the labels at the top level keeps them when the estimate is used with
+	// the dimensions of the SLO
+	return aggregateBy("max", v.By, "\n  "+strings.Replace(estimate, "\n", "\n  ", -1)+"\n")
+}
+
+// idlePolicy decides how intervals are scored where a batch job isn't running, and so has
+// no measure of throughput.
+type idlePolicy string
+
+const (
+	idleExcluded idlePolicy = "excluded" // intervals don't contribute to the error rate
+	idleGood     idlePolicy = "good"     // intervals are scored as 0% error
+)
+
+func (p *idlePolicy) UnmarshalJSON(payload []byte) error {
+	var human string
+	if err := json.Unmarshal(payload, &human); err != nil {
+		return err
+	}
+
+	switch policy := idlePolicy(human); policy {
+	case idleExcluded, idleGood:
+		*p = policy
+		return nil
+	}
+
+	return fmt.Errorf("invalid idle policy %q, expected one of: %s, %s", human, idleExcluded, idleGood)
+}
+
+func (p idlePolicy) String() string {
+	if p == "" {
+		return string(idleExcluded)
+	}
+
+	return string(p)
+}
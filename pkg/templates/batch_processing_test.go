@@ -0,0 +1,103 @@
+package templates
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestBatchProcessingSLORecoup(t *testing.T) {
+	recoup := mustParseSLO(t, "BatchProcessingSLO", `
+name: Recoup
+budget: 0.1
+deadline: 10m
+volume: vector(600)
+throughput: rate(processed_total[1m]) > 0
+recoup: true
+run: run_id
+`)
+
+	plain := mustParseSLO(t, "BatchProcessingSLO", `
+name: Plain
+budget: 0.1
+deadline: 10m
+volume: vector(600)
+throughput: sum(rate(processed_total[1m]) > 0)
+`)
+
+	// The target is 1/s. The first run processes 0.5/s, and the second 1.5/s after an idle
+	// minute between them.
+	test := evalSLOs(t, `
+load 1m
+  processed_total{run_id="1"} 0 30 60
+  processed_total{run_id="2"} _ _ _ 0 90 180
+`, 5, recoup, plain)
+	defer test.Close()
+
+	test.assertValue(`job:slo_batch_error:interval{name="Recoup", run="1"}`, minute(2), 0.5)
+	test.assertValue(`job:slo_batch_error:interval{name="Recoup", run="2"}`, minute(4), -0.5)
+	test.assertAbsent(`job:slo_batch_error:interval{name="Recoup"}`, minute(3))
+
+	// The second run exceeding its target can't recoup the budget lost by the first
+	test.assertValue(`job:slo_error:ratio5m{name="Recoup"}`, minute(5), 0.25)
+	test.assertValue(`job:slo_error:ratio5m{name="Plain"}`, minute(5), 0.25)
+}
+
+func TestBatchProcessingSLOValidate(t *testing.T) {
+	for _, tc := range []struct {
+		definition string
+		err        string
+	}{
+		{"deadline: 10m\nvolume: vector(600)", "throughput must be provided"},
+		{"volume: vector(600)\nthroughput: sum(rate(processed_total[1m]))", "deadline must be a positive duration"},
+		{"deadline: 0s\nvolume: vector(600)\nthroughput: sum(rate(processed_total[1m]))", "deadline must be a positive duration"},
+	} {
+		err := parseSLOError(t, "BatchProcessingSLO", "name: Batch\nbudget: 0.1\n"+tc.definition)
+		if !strings.Contains(err.Error(), tc.err) {
+			t.Errorf("expected error containing %q, got %v", tc.err, err)
+		}
+	}
+
+	parseSLOError(t, "BatchProcessingSLO", `
+name: Recoup
+budget: 0.1
+deadline: 10m
+volume: vector(600)
+throughput: sum(rate(processed_total[1m]))
+recoup: true
+`)
+
+	parseSLOError(t, "BatchProcessingSLO", `
+name: Recoup
+budget: 0.1
+deadline: 10m
+volume: vector(600)
+throughput: sum(rate(processed_total[1m]))
+run: run_id
+`)
+
+	// Throughput that is already aggregated must keep the run label
+	parseSLOError(t, "BatchProcessingSLO", `
+name: Recoup
+budget: 0.1
+deadline: 10m
+volume: vector(600)
+throughput: sum(rate(processed_total[1m]))
+recoup: true
+run: run_id
+`)
+}
+
+func TestVolumeEstimateDimensions(t *testing.T) {
+	mustParseSLO(t, "BatchProcessingSLO", `
+name: Batch
+budget: 0.1
+deadline: 2h
+dimensions: [namespace, release]
+volumeEstimate:
+  counter: processed_total
+  lookback: 8h
+  history: 60d
+  growth: 1.5
+throughput: rate(processed_total[1m]) > 0
+`)
+}
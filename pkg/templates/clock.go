@@ -0,0 +1,228 @@
+package templates
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+var (
+	// TimezoneTransitionsFrom and TimezoneTransitionsUntil bound the UTC offset changes
+	// (such as daylight saving) that are compiled into the PromQL for SLOs that work in
+	// wall-clock time. Rules that depend on a timezone must be regenerated before the end
+	// of this range, after which the last known UTC offset is used forever.
+	TimezoneTransitionsFrom  = time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+	TimezoneTransitionsUntil = time.Date(2040, time.January, 1, 0, 0, 0, 0, time.UTC)
+)
+
+// localTime produces a PromQL instant vector whose value is the current wall-clock time
+// in the given location, expressed as if it were a unix timestamp. This allows the
+// hour(), minute() and day_of_week() functions, which only understand UTC, to be used
+// to reason about local time.
+//
+// Prometheus has no notion of timezones, so we compute every change in UTC offset for
+// the location in Go, then sum the change in offset for each transition that time() has
+// passed. For Europe/London this looks like:
+//
+//	vector(time() + 3600 * (time() >= bool 1711846800) - 3600 * (time() >= bool 1729990800) ...)
+//
+// The time is shifted back by the delay, as with evaluationTime.
+func localTime(loc *time.Location, delay time.Duration) string {
+	_, offset := TimezoneTransitionsFrom.In(loc).Zone()
+
+	now := evaluationTime(delay)
+	expr := now
+	if offset != 0 {
+		expr += fmt.Sprintf(" + %d", offset)
+	}
+
+	for _, transition := range utcOffsetTransitions(loc, TimezoneTransitionsFrom, TimezoneTransitionsUntil) {
+		_, next := transition.In(loc).Zone()
+		delta, op := next-offset, "+"
+		if delta < 0 {
+			delta, op = -delta, "-"
+		}
+
+		expr += fmt.Sprintf(" %s %d * (%s >= bool %d)", op, delta, now, transition.Unix())
+		offset = next
+	}
+
+	return fmt.Sprintf("vector(%s)", expr)
+}
+
+// evaluationTime is time() shifted back by the delay of an SLO, so that rules based on
+// the clock line up with the delayed data they're combined with
+func evaluationTime(delay time.Duration) string {
+	if delay <= 0 {
+		return "time()"
+	}
+
+	return fmt.Sprintf("time() - %d", delay/time.Second)
+}
+
+// utcOffsetTransitions finds every instant between from and until at which the UTC
+// offset of loc changes. Offsets are assumed to change at most once per day, which holds
+// for every timezone in the tz database.
+func utcOffsetTransitions(loc *time.Location, from, until time.Time) []time.Time {
+	transitions := []time.Time{}
+	for day := from; day.Before(until); day = day.Add(24 * time.Hour) {
+		_, before := day.In(loc).Zone()
+		_, after := day.Add(24 * time.Hour).In(loc).Zone()
+		if before == after {
+			continue
+		}
+
+		// Binary search for the first second that has the new offset
+		lo, hi := day.Unix(), day.Add(24*time.Hour).Unix()
+		for hi-lo > 1 {
+			mid := lo + (hi-lo)/2
+			if _, offset := time.Unix(mid, 0).In(loc).Zone(); offset == before {
+				lo = mid
+			} else {
+				hi = mid
+			}
+		}
+
+		transitions = append(transitions, time.Unix(hi, 0).UTC())
+	}
+
+	return transitions
+}
+
+// serializeableLocation supports unmarshaling from JSON using a timezone name from the tz
+// database, such as Europe/London. The zero value is UTC.
+type serializeableLocation struct {
+	*time.Location
+}
+
+func (l *serializeableLocation) UnmarshalJSON(payload []byte) error {
+	var name string
+	if err := json.Unmarshal(payload, &name); err != nil {
+		return err
+	}
+
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return fmt.Errorf("invalid timezone %q: %v", name, err)
+	}
+
+	l.Location = loc
+	return nil
+}
+
+func (l serializeableLocation) location() *time.Location {
+	if l.Location == nil {
+		return time.UTC
+	}
+
+	return l.Location
+}
+
+// serializeableTimeOfDay is a wall-clock time written as 15:04, stored as the duration
+// since midnight.
+type serializeableTimeOfDay time.Duration
+
+func (t *serializeableTimeOfDay) UnmarshalJSON(payload []byte) error {
+	var human string
+	if err := json.Unmarshal(payload, &human); err != nil {
+		return err
+	}
+
+	parsed, err := time.Parse("15:04", human)
+	if err != nil {
+		return fmt.Errorf("invalid time of day %q, expected HH:MM", human)
+	}
+
+	*t = serializeableTimeOfDay(time.Duration(parsed.Hour())*time.Hour + time.Duration(parsed.Minute())*time.Minute)
+	return nil
+}
+
+func (t serializeableTimeOfDay) String() string {
+	return fmt.Sprintf("%02d:%02d", time.Duration(t)/time.Hour, time.Duration(t)%time.Hour/time.Minute)
+}
+
+// serializeableWeekday supports unmarshaling weekdays by their full or abbreviated
+// English name, such as monday or mon.
+type serializeableWeekday time.Weekday
+
+func (w *serializeableWeekday) UnmarshalJSON(payload []byte) error {
+	var human string
+	if err := json.Unmarshal(payload, &human); err != nil {
+		return err
+	}
+
+	for day := time.Sunday; day <= time.Saturday; day++ {
+		name := strings.ToLower(day.String())
+		if strings.ToLower(human) == name || strings.ToLower(human) == name[:3] {
+			*w = serializeableWeekday(day)
+			return nil
+		}
+	}
+
+	return fmt.Errorf("invalid weekday %q", human)
+}
+
+// businessDays is used whenever a schedule doesn't specify which days it applies to
+var businessDays = []serializeableWeekday{
+	serializeableWeekday(time.Monday),
+	serializeableWeekday(time.Tuesday),
+	serializeableWeekday(time.Wednesday),
+	serializeableWeekday(time.Thursday),
+	serializeableWeekday(time.Friday),
+}
+
+// weekdayNames renders weekdays as a stable, comma separated list for use in labels
+func weekdayNames(weekdays []serializeableWeekday) string {
+	sorted := append([]serializeableWeekday{}, weekdays...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	names := []string{}
+	for _, weekday := range sorted {
+		names = append(names, strings.ToLower(time.Weekday(weekday).String()[:3]))
+	}
+
+	return strings.Join(names, ",")
+}
+
+// onWeekdays filters the given local time vector to only those instants that fall on one
+// of the weekdays, using day_of_week() which numbers days from Sunday = 0.
+func onWeekdays(local string, weekdays []serializeableWeekday) string {
+	matches := []string{}
+	for _, weekday := range weekdays {
+		matches = append(matches, fmt.Sprintf("day_of_week(%s) == %d", local, weekday))
+	}
+
+	return strings.Join(matches, " or ")
+}
+
+// serializeableDate is a calendar date written as 2006-01-02, with no timezone
+type serializeableDate struct {
+	time.Time
+}
+
+func (d *serializeableDate) UnmarshalJSON(payload []byte) error {
+	var human string
+	if err := json.Unmarshal(payload, &human); err != nil {
+		return err
+	}
+
+	parsed, err := time.Parse("2006-01-02", human)
+	if err != nil {
+		return fmt.Errorf("invalid date %q, expected YYYY-MM-DD", human)
+	}
+
+	d.Time = parsed
+	return nil
+}
+
+func (d serializeableDate) String() string {
+	return d.Format("2006-01-02")
+}
+
+// epochDay is the number of days between the unix epoch and the date, which matches the
+// day of a local time vector computed as floor(local / 86400)
+func (d serializeableDate) epochDay() int64 {
+	return d.Unix() / int64(24*time.Hour/time.Second)
+}
@@ -0,0 +1,104 @@
+package templates
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/prometheus/pkg/rulefmt"
+)
+
+// withTimezoneTransitions compiles the UTC offset changes of the given range into rules
+// until the returned function is called, so tests can use fixed dates
+func withTimezoneTransitions(from, until time.Time) func() {
+	previousFrom, previousUntil := TimezoneTransitionsFrom, TimezoneTransitionsUntil
+	TimezoneTransitionsFrom, TimezoneTransitionsUntil = from, until
+
+	return func() {
+		TimezoneTransitionsFrom, TimezoneTransitionsUntil = previousFrom, previousUntil
+	}
+}
+
+// evalAt records the rules at a single instant, against no series
+func evalAt(t *testing.T, rules []rulefmt.Rule, ts time.Time) *ruleTest {
+	test := newRuleTest(t, "")
+	test.record(rules, ts, ts, time.Minute)
+
+	return test
+}
+
+func TestUTCOffsetTransitions(t *testing.T) {
+	london, err := time.LoadLocation("Europe/London")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	transitions := utcOffsetTransitions(
+		london,
+		time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC),
+		time.Date(2021, time.January, 1, 0, 0, 0, 0, time.UTC),
+	)
+
+	expected := []time.Time{
+		time.Date(2020, time.March, 29, 1, 0, 0, 0, time.UTC),
+		time.Date(2020, time.October, 25, 1, 0, 0, 0, time.UTC),
+	}
+
+	if len(transitions) != len(expected) {
+		t.Fatalf("expected transitions %v, got %v", expected, transitions)
+	}
+
+	for idx := range expected {
+		if !transitions[idx].Equal(expected[idx]) {
+			t.Errorf("expected transition %v, got %v", expected[idx], transitions[idx])
+		}
+	}
+}
+
+func TestLocalTime(t *testing.T) {
+	defer withTimezoneTransitions(
+		time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC),
+		time.Date(2021, time.January, 1, 0, 0, 0, 0, time.UTC),
+	)()
+
+	london, err := time.LoadLocation("Europe/London")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rules := []rulefmt.Rule{{Record: "local_time", Expr: localTime(london, 0)}}
+	for _, ts := range []time.Time{
+		time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC),
+		time.Date(2020, time.March, 29, 0, 59, 59, 0, time.UTC),
+		time.Date(2020, time.March, 29, 1, 0, 0, 0, time.UTC),
+		time.Date(2020, time.July, 1, 12, 0, 0, 0, time.UTC),
+		time.Date(2020, time.October, 25, 0, 59, 59, 0, time.UTC),
+		time.Date(2020, time.October, 25, 1, 0, 0, 0, time.UTC),
+		time.Date(2020, time.December, 31, 23, 0, 0, 0, time.UTC),
+	} {
+		_, offset := ts.In(london).Zone()
+
+		test := evalAt(t, rules, ts)
+		test.assertValue("local_time", ts, float64(ts.Unix()+int64(offset)))
+		test.Close()
+	}
+
+	// A delay shifts the clock back, so the transition is seen 5m late
+	delayed := []rulefmt.Rule{{Record: "local_time", Expr: localTime(london, 5*time.Minute)}}
+	for _, tc := range []struct {
+		ts       time.Time
+		expected time.Time
+	}{
+		{
+			ts:       time.Date(2020, time.March, 29, 1, 4, 59, 0, time.UTC),
+			expected: time.Date(2020, time.March, 29, 0, 59, 59, 0, time.UTC),
+		},
+		{
+			ts:       time.Date(2020, time.March, 29, 1, 5, 0, 0, time.UTC),
+			expected: time.Date(2020, time.March, 29, 2, 0, 0, 0, time.UTC),
+		},
+	} {
+		test := evalAt(t, delayed, tc.ts)
+		test.assertValue("local_time", tc.ts, float64(tc.expected.Unix()))
+		test.Close()
+	}
+}
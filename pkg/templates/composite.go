@@ -0,0 +1,231 @@
+package templates
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/prometheus/pkg/rulefmt"
+)
+
+func init() {
+	MustRegisterTemplate(CompositeSLO{})
+}
+
+// CompositeSLO is used to construct SLOs for user journeys that span several systems,
+// each of which already has an SLO of its own. Creating a payment might touch an API, a
+// fraud check and a payment scheduler, and while each of these have their own objectives,
+// the customer only experiences the journey as a whole.
+//
+// To use this template, you reference the names of other SLOs, and choose a strategy for
+// combining their job:slo_error:ratio<I> series into one:
+//
+//   - weighted: average of the component error ratios, using each component's weight
+//   - worst: the highest error ratio of any component
+//   - product: treats each component as a step that must succeed, so the journey success
+//     rate is the product of each component's success rate
+//
+// Each component's error ratio is first reduced to a single series by taking the worst
+// of its series, or to one series per combination of dimensions if the composite declares
+// them, in which case every component must have the same dimensions. A component with no
+// error ratio, such as one with no traffic, counts as 0% error rather than leaving the
+// composite without an error ratio. The composite SLO has an error budget and alerts of
+// its own, which are independent of those of its components.
+//
+// Composite SLOs can reference other composite SLOs, but references must exist and must
+// not form a cycle. Exclusions and schedules belong to the components, whose error ratios
+// already leave out the time they exclude, so the composite doesn't support its own.
+type CompositeSLO struct {
+	baseSLO
+	Strategy   compositeStrategy    // how to combine the error ratios of the components, defaulting to weighted
+	Components []compositeComponent // SLOs that make up the composite
+}
+
+type compositeComponent struct {
+	Name   string   // name of the SLO to reference
+	Weight *float64 // relative weight of the component in the weighted strategy, defaulting to 1
+}
+
+func (c compositeComponent) weight() float64 {
+	if c.Weight == nil {
+		return 1.0
+	}
+
+	return *c.Weight
+}
+
+func (c CompositeSLO) Validate() error {
+	if len(c.Components) == 0 {
+		return fmt.Errorf("composite must reference at least one component")
+	}
+
+	total := 0.0
+	for _, component := range c.Components {
+		if component.weight() < 0 {
+			return fmt.Errorf("component %s must not have a negative weight", component.Name)
+		}
+
+		total += component.weight()
+	}
+
+	if c.Strategy.String() == string(compositeWeighted) && total == 0 {
+		return fmt.Errorf("at least one component must have a positive weight")
+	}
+
+	if c.limited() {
+		return fmt.Errorf("maxSeries and topk aren't supported, as the components are already limited")
+	}
+
+	if c.excluded() {
+		return fmt.Errorf("exclusions and schedules aren't supported, as the components apply their own")
+	}
+
+	return nil
+}
+
+// Dependencies implements dependentSLO, as we can only compute the composite error ratio
+// once each of the components' error ratios are available.
+func (c CompositeSLO) Dependencies() []string {
+	names := []string{}
+	for _, component := range c.Components {
+		names = append(names, component.Name)
+	}
+
+	return names
+}
+
+// validateDependency implements dependencyValidator, checking that each component can be
+// matched to the dimensions of the composite.
+func (c CompositeSLO) validateDependency(component SLO) error {
+	if len(c.Dimensions) == 0 {
+		return nil
+	}
+
+	var dimensions []string
+	if dimensioned, ok := component.(interface{ dimensions() []string }); ok {
+		dimensions = dimensioned.dimensions()
+	}
+
+	if !sameLabels(dimensions, c.Dimensions) {
+		return fmt.Errorf(
+			"component %s has dimensions (%s), which don't match the dimensions of the composite (%s)",
+			component.GetName(), strings.Join(dimensions, ", "), strings.Join(c.Dimensions, ", "),
+		)
+	}
+
+	return nil
+}
+
+func (c CompositeSLO) Rules() []rulefmt.Rule {
+	components := []string{}
+	for _, component := range c.Components {
+		components = append(
+			components, fmt.Sprintf("%s=%s", component.Name, strconv.FormatFloat(component.weight(), 'f', -1, 64)),
+		)
+	}
+
+	return flattenRules(
+		c.baseSLO.Rules(
+			map[string]string{
+				"template":   "CompositeSLO",
+				"strategy":   c.Strategy.String(),
+				"components": strings.Join(components, ","),
+			},
+		),
+		forIntervals(AlertWindows, rulefmt.Rule{
+			Record: "job:slo_error:ratio%s",
+			Labels: c.joinLabels(),
+			Expr:   c.expr(),
+		}),
+	)
+}
+
+// expr combines the error ratio of each component, leaving a %[1]s placeholder for the
+// alert window
+func (c CompositeSLO) expr() string {
+	names := []string{}
+	for _, component := range c.Components {
+		names = append(names, regexp.QuoteMeta(component.Name))
+	}
+
+	matchAll := fmt.Sprintf(`job:slo_error:ratio%%[1]s{name=~%s}`, strconv.Quote(strings.Join(names, "|")))
+	if c.Strategy == compositeWorst {
+		return aggregateBy("max", c.Dimensions, matchAll)
+	}
+
+	// Components without an error ratio count as 0% error. With dimensions, this has to
+	// be done for every combination that any of the components have.
+	absent := "vector(0)"
+	if len(c.Dimensions) > 0 {
+		absent = "0 * " + aggregateBy("max", c.Dimensions, matchAll)
+	}
+
+	ratios := []string{}
+	for _, component := range c.Components {
+		ratios = append(ratios, fmt.Sprintf(
+			"(%s or %s)",
+			aggregateBy("max", c.Dimensions, fmt.Sprintf(`job:slo_error:ratio%%[1]s{name="%s"}`, component.Name)),
+			absent,
+		))
+	}
+
+	switch c.Strategy {
+	case compositeProduct:
+		successes := []string{}
+		for _, ratio := range ratios {
+			successes = append(successes, fmt.Sprintf("(1 - %s)", ratio))
+		}
+
+		return fmt.Sprintf("1 - (\n  %s\n)", strings.Join(successes, "\n  * "))
+
+	default:
+		weighted, total := []string{}, 0.0
+		for idx, component := range c.Components {
+			weighted = append(
+				weighted, fmt.Sprintf("%s * %s", strconv.FormatFloat(component.weight(), 'f', -1, 64), ratios[idx]),
+			)
+			total += component.weight()
+		}
+
+		return fmt.Sprintf(
+			"(\n  %s\n) / %s", strings.Join(weighted, "\n  + "), strconv.FormatFloat(total, 'f', -1, 64),
+		)
+	}
+}
+
+// compositeStrategy decides how the error ratios of composite components are combined
+type compositeStrategy string
+
+const (
+	compositeWeighted compositeStrategy = "weighted"
+	compositeWorst    compositeStrategy = "worst"
+	compositeProduct  compositeStrategy = "product"
+)
+
+func (s *compositeStrategy) UnmarshalJSON(payload []byte) error {
+	var human string
+	if err := json.Unmarshal(payload, &human); err != nil {
+		return err
+	}
+
+	switch strategy := compositeStrategy(human); strategy {
+	case compositeWeighted, compositeWorst, compositeProduct:
+		*s = strategy
+		return nil
+	}
+
+	return fmt.Errorf(
+		"invalid composite strategy %q, expected one of: %s, %s, %s",
+		human, compositeWeighted, compositeWorst, compositeProduct,
+	)
+}
+
+func (s compositeStrategy) String() string {
+	if s == "" {
+		return string(compositeWeighted)
+	}
+
+	return string(s)
+}
@@ -0,0 +1,101 @@
+package templates
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// requestsSLO is an ErrorRateSLO of requests to the app
+func requestsSLO(t *testing.T, name, app, extra string) SLO {
+	return mustParseSLO(t, "ErrorRateSLO", fmt.Sprintf(`
+name: %s
+budget: 0.01
+errors: rate(requests_total{app="%s", status="500"}[5m])
+total: rate(requests_total{app="%s"}[5m])
+%s
+`, name, app, app, extra))
+}
+
+func TestCompositeSLO(t *testing.T) {
+	slos := []SLO{
+		requestsSLO(t, "API", "api", "dimensions: [namespace]"),
+		requestsSLO(t, "Idle", "idle", "dimensions: [namespace]"),
+		mustParseSLO(t, "CompositeSLO", `
+name: Weighted
+budget: 0.01
+components: [{name: API, weight: 3}, {name: Idle}]
+`),
+		mustParseSLO(t, "CompositeSLO", `
+name: Unweighted
+budget: 0.01
+components: [{name: API, weight: 0}, {name: Idle}]
+`),
+		mustParseSLO(t, "CompositeSLO", `
+name: Product
+budget: 0.01
+strategy: product
+components: [{name: API}, {name: Idle}]
+`),
+		mustParseSLO(t, "CompositeSLO", `
+name: Dimensions
+budget: 0.01
+dimensions: [namespace]
+components: [{name: API}, {name: Idle}]
+`),
+	}
+
+	// Idle has no requests, so no error ratio
+	test := evalSLOs(t, `
+load 1m
+  requests_total{app="api", namespace="payments", status="200"} 0+9x10
+  requests_total{app="api", namespace="payments", status="500"} 0+1x10
+`, 10, slos...)
+	defer test.Close()
+
+	test.assertAbsent(`job:slo_error:ratio5m{name="Idle"}`, minute(10))
+	test.assertValue(`job:slo_error:ratio5m{name="API"}`, minute(10), 0.1)
+
+	test.assertValue(`job:slo_error:ratio5m{name="Weighted"}`, minute(10), 0.075)
+	test.assertValue(`job:slo_error:ratio5m{name="Unweighted"}`, minute(10), 0)
+	test.assertValue(`job:slo_error:ratio5m{name="Product"}`, minute(10), 0.1)
+	test.assertValue(`job:slo_error:ratio5m{name="Dimensions", namespace="payments"}`, minute(10), 0.05)
+}
+
+func TestCompositeSLOExpr(t *testing.T) {
+	slo := mustParseSLO(t, "CompositeSLO", `
+name: Journey
+budget: 0.01
+dimensions: [namespace]
+strategy: worst
+components: [{name: API}, {name: Idle}]
+`)
+
+	expected := `max by (namespace) (job:slo_error:ratio%[1]s{name=~"API|Idle"})`
+	if got := slo.(*CompositeSLO).expr(); got != expected {
+		t.Errorf("unexpected expression\n  got: %s\n  expected: %s", got, expected)
+	}
+}
+
+func TestCompositeSLOValidate(t *testing.T) {
+	parseSLOError(t, "CompositeSLO", `
+name: Journey
+budget: 0.01
+components: [{name: API, weight: 0}, {name: Idle, weight: 0}]
+`)
+
+	_, err := SortByDependencies([]SLO{
+		requestsSLO(t, "API", "api", ""),
+		mustParseSLO(t, "CompositeSLO", `
+name: Journey
+budget: 0.01
+dimensions: [namespace]
+components: [{name: API}]
+`),
+	})
+
+	expected := "component API has dimensions (), which don't match the dimensions of the composite (namespace)"
+	if err == nil || !strings.Contains(err.Error(), expected) {
+		t.Errorf("expected error containing %q, got %v", expected, err)
+	}
+}
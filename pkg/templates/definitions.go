@@ -0,0 +1,587 @@
+package templates
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/ghodss/yaml"
+)
+
+// Definition is a single SLO definition, as provided in a definitions file once defaults
+// have been applied. It hasn't yet been parsed into its template, so can be inspected or
+// printed even if it isn't valid.
+type Definition struct {
+	Template   string                 `json:"template"`
+	Definition map[string]interface{} `json:"definition"`
+	Source     string                 `json:"-"` // file the definition was loaded from, for errors
+}
+
+// SLO parses the definition into its registered template, validating it
+func (d Definition) SLO() (SLO, error) {
+	payload, err := json.Marshal(d)
+	if err != nil {
+		return nil, err
+	}
+
+	var envelope sloEnvelope
+	if err := json.Unmarshal(payload, &envelope); err != nil {
+		return nil, err
+	}
+
+	return envelope.SLO, nil
+}
+
+// definitionDefaults are deep-merged under every definition in the file. Global defaults
+// apply to all definitions, then the defaults for the template of the definition, then
+// the definition itself, with later values taking precedence.
+type definitionDefaults struct {
+	Global    map[string]interface{}            `json:"global"`
+	Templates map[string]map[string]interface{} `json:"templates"`
+}
+
+// matrixDefinition is a definition as it appears in a definitions file, which may be
+// expanded into several definitions by its matrix
+type matrixDefinition struct {
+	Definition
+	Matrix []map[string]interface{} `json:"matrix"`
+}
+
+// exclusiveFields are groups of definition fields of which only one may be provided. A
+// value for any field in a group replaces the values of the others from lower precedence
+// layers, so a definition can give an objective even when the defaults provide a budget.
+var exclusiveFields = [][]string{
+	{"budget", "objective"},
+}
+
+// ResolveDefinitions loads a YAML file of definitions, applying any defaults:
+//
+//	---
+//	defaults:
+//	  global:
+//	    budget: 0.001
+//	    labels:
+//	      channel: slo-alerts
+//	  templates:
+//	    ErrorRateSLO:
+//	      dimensions: [namespace, release]
+//	definitions:
+//	  - template: ErrorRateSLO
+//	    definition:
+//	      name: PaymentsServiceSearchErrors
+//	      ...
+//
+// Maps are merged recursively, while lists and other values replace the defaults
+// entirely. Setting a field to null removes its default.
+//
+// A definition with a matrix is expanded into one definition for each entry of the
+// matrix, substituting the variables of the entry wherever ${variable} appears in the
+// definition, once defaults have been applied:
+//
+//	definitions:
+//	  - template: ErrorRateSLO
+//	    matrix:
+//	      - service: payments-service
+//	        budget: 0.001
+//	      - service: mandates-service
+//	        budget: 0.01
+//	    definition:
+//	      name: ${service}-errors
+//	      budget: ${budget}
+//	      errors: sum(rate(http_requests_total{app="${service}", status=~"5.."}[5m]))
+//	      ...
+//
+// Values that are entirely a single variable are replaced by the value of the variable,
+// so can be numbers or lists, while variables within longer strings are formatted into
+// them.
+//
+// Fragments of PromQL shared between definitions can be given once, and referenced as
+// ${fragment} in any field, including the values of a matrix. They are expanded once
+// defaults have been applied, but before any matrix, so fragments may themselves
+// reference the variables of a matrix:
+//
+//	---
+//	fragments:
+//	  search: app="payments-service", handler=~"Routes::(Admin)?Search"
+//	definitions:
+//	  - template: ErrorRateSLO
+//	    definition:
+//	      errors: sum(rate(http_requests_total{${search}, status=~"5.."}[%s]))
+//	      total: sum(rate(http_requests_total{${search}}[%s]))
+//	      ...
+func ResolveDefinitions(payload []byte) ([]Definition, error) {
+	envelope := struct {
+		Fragments   map[string]string  `json:"fragments"`
+		Defaults    definitionDefaults `json:"defaults"`
+		Definitions []matrixDefinition `json:"definitions"`
+	}{}
+
+	if err := unmarshalYAML(payload, &envelope); err != nil {
+		return nil, err
+	}
+
+	fragments, err := resolveFragments(envelope.Fragments)
+	if err != nil {
+		return nil, err
+	}
+
+	for template := range envelope.Defaults.Templates {
+		if _, ok := Templates[template]; !ok {
+			return nil, fmt.Errorf("defaults provided for unsupported template type: %s", template)
+		}
+	}
+
+	definitions := []Definition{}
+	for _, definition := range envelope.Definitions {
+		merged := mergeDefinitions(
+			canonicalFields(definition.Template, envelope.Defaults.Global),
+			canonicalFields(definition.Template, envelope.Defaults.Templates[definition.Template]),
+			canonicalFields(definition.Template, definition.Definition.Definition),
+		)
+
+		substituted, err := substituteVariables(merged, fragments, true)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s definition %v: %v", definition.Template, merged["name"], err)
+		}
+
+		resolved := Definition{Template: definition.Template, Definition: substituted.(map[string]interface{})}
+
+		if definition.Matrix == nil {
+			// Without a matrix, any reference that remains was never defined
+			if _, err := substituteVariables(resolved.Definition, map[string]interface{}{}, false); err != nil {
+				return nil, fmt.Errorf("invalid %s definition %v: %v", definition.Template, merged["name"], err)
+			}
+
+			definitions = append(definitions, resolved)
+			continue
+		}
+
+		if len(definition.Matrix) == 0 {
+			return nil, fmt.Errorf("invalid matrix for %s definition %v: matrix must have at least one entry", definition.Template, merged["name"])
+		}
+
+		// Matrix values can reference fragments, but not each other
+		matrix := []map[string]interface{}{}
+		for idx, variables := range definition.Matrix {
+			for variable := range variables {
+				if _, ok := fragments[variable]; ok {
+					return nil, fmt.Errorf("invalid matrix for %s definition %v: variable %s has the same name as a fragment", definition.Template, merged["name"], variable)
+				}
+			}
+
+			substituted, err := substituteVariables(variables, fragments, false)
+			if err != nil {
+				return nil, fmt.Errorf("invalid matrix for %s definition %v: entry %d: %v", definition.Template, merged["name"], idx, err)
+			}
+
+			matrix = append(matrix, substituted.(map[string]interface{}))
+		}
+
+		expanded, err := resolved.expand(matrix)
+		if err != nil {
+			return nil, fmt.Errorf("invalid matrix for %s definition %v: %v", definition.Template, resolved.Definition["name"], err)
+		}
+
+		definitions = append(definitions, expanded...)
+	}
+
+	// Names must be unique across the file, or patches and dependencies would be ambiguous
+	names := map[string]bool{}
+	for _, definition := range definitions {
+		name, ok := definition.Definition["name"].(string)
+		if !ok {
+			continue
+		}
+
+		if names[name] {
+			return nil, fmt.Errorf("more than one definition has the name %s", name)
+		}
+
+		names[name] = true
+	}
+
+	return definitions, nil
+}
+
+// expand produces a definition for each entry of the matrix, ensuring each has a
+// different name
+func (d Definition) expand(matrix []map[string]interface{}) ([]Definition, error) {
+	definitions := []Definition{}
+	names := map[string]int{}
+	for idx, variables := range matrix {
+		substituted, err := substituteVariables(d.Definition, variables, false)
+		if err != nil {
+			return nil, fmt.Errorf("entry %d: %v", idx, err)
+		}
+
+		definition := Definition{Template: d.Template, Definition: substituted.(map[string]interface{})}
+		name := fmt.Sprintf("%v", definition.Definition["name"])
+		if previous, ok := names[name]; ok {
+			return nil, fmt.Errorf("entries %d and %d both expand to the name %s", previous, idx, name)
+		}
+
+		names[name] = idx
+		definitions = append(definitions, definition)
+	}
+
+	return definitions, nil
+}
+
+// variableReference matches a ${variable} in a definition
+var variableReference = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// substituteVariables replaces each ${variable} in the strings of the value, recursing
+// into maps and lists. Referencing a variable that isn't provided is an error, unless
+// partial, in which case the reference is left to be substituted later.
+func substituteVariables(value interface{}, variables map[string]interface{}, partial bool) (interface{}, error) {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		substituted := map[string]interface{}{}
+		for key, elem := range value {
+			var err error
+			if substituted[key], err = substituteVariables(elem, variables, partial); err != nil {
+				return nil, err
+			}
+		}
+
+		return substituted, nil
+	case []interface{}:
+		substituted := []interface{}{}
+		for _, elem := range value {
+			elem, err := substituteVariables(elem, variables, partial)
+			if err != nil {
+				return nil, err
+			}
+
+			substituted = append(substituted, elem)
+		}
+
+		return substituted, nil
+	case string:
+		if match := variableReference.FindStringSubmatch(value); match != nil && match[0] == value {
+			variable, ok := variables[match[1]]
+			if !ok && partial {
+				return value, nil
+			}
+
+			if !ok {
+				return nil, fmt.Errorf("undefined reference %s", match[0])
+			}
+
+			return variable, nil
+		}
+
+		var err error
+		substituted := variableReference.ReplaceAllStringFunc(value, func(reference string) string {
+			name := variableReference.FindStringSubmatch(reference)[1]
+			switch variable := variables[name].(type) {
+			case nil:
+				if !partial {
+					err = fmt.Errorf("undefined reference %s", reference)
+				}
+			case map[string]interface{}, []interface{}:
+				err = fmt.Errorf("variable %s can't be formatted into %q, as it isn't a single value", name, value)
+			default:
+				return fmt.Sprintf("%v", variable)
+			}
+
+			return reference
+		})
+
+		return substituted, err
+	}
+
+	return value, nil
+}
+
+// definitionPatch overrides fields of the definition with the given name
+type definitionPatch struct {
+	Name       string                 `json:"name"`
+	Definition map[string]interface{} `json:"definition"`
+}
+
+// ApplyOverlay patches resolved definitions with the contents of an overlay file, such as
+// the overrides needed in a particular environment:
+//
+//	---
+//	patches:
+//	  - name: PaymentsServiceSearchErrors
+//	    definition:
+//	      budget: 0.01
+//	      labels:
+//	        channel: slo-alerts-staging
+//
+// Each patch is deep-merged onto the definition with the same name, exactly as a
+// definition is merged onto its defaults. Patching a definition that doesn't exist is an
+// error, as it is almost certainly a typo or a definition that has since been renamed.
+func ApplyOverlay(definitions []Definition, payload []byte) ([]Definition, error) {
+	envelope := struct {
+		Patches []definitionPatch `json:"patches"`
+	}{}
+
+	if err := unmarshalYAML(payload, &envelope); err != nil {
+		return nil, err
+	}
+
+	patched := make([]Definition, len(definitions))
+	copy(patched, definitions)
+
+	for _, patch := range envelope.Patches {
+		found := false
+		for idx, definition := range patched {
+			if definition.Definition["name"] != patch.Name {
+				continue
+			}
+
+			fields := canonicalFields(definition.Template, patch.Definition)
+			if _, ok := fields["name"]; ok {
+				return nil, fmt.Errorf("patch for %s can't rename the definition", patch.Name)
+			}
+
+			found = true
+			patched[idx].Definition = mergeDefinitions(definition.Definition, fields)
+		}
+
+		if !found {
+			return nil, fmt.Errorf("patch for %s doesn't match any definition", patch.Name)
+		}
+	}
+
+	return patched, nil
+}
+
+// resolveFragments expands the references fragments make to each other, so each can be
+// substituted into definitions directly. References to anything other than a fragment
+// are left for the variables of a matrix.
+func resolveFragments(fragments map[string]string) (map[string]interface{}, error) {
+	names := []string{}
+	for name := range fragments {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	resolved := map[string]interface{}{}
+	var resolve func(name string, path []string) error
+	resolve = func(name string, path []string) error {
+		if _, ok := resolved[name]; ok {
+			return nil
+		}
+
+		for _, seen := range path {
+			if seen == name {
+				return fmt.Errorf("fragments reference each other in a cycle: %s", strings.Join(append(path, name), " -> "))
+			}
+		}
+
+		var err error
+		resolved[name] = variableReference.ReplaceAllStringFunc(fragments[name], func(reference string) string {
+			other := variableReference.FindStringSubmatch(reference)[1]
+			if _, ok := fragments[other]; !ok || err != nil {
+				return reference
+			}
+
+			if err = resolve(other, append(path, name)); err != nil {
+				return reference
+			}
+
+			return resolved[other].(string)
+		})
+
+		if err != nil {
+			delete(resolved, name)
+		}
+
+		return err
+	}
+
+	for _, name := range names {
+		if err := resolve(name, []string{}); err != nil {
+			return nil, err
+		}
+	}
+
+	return resolved, nil
+}
+
+// MarshalDefinitions renders resolved definitions in the format of a definitions file
+func MarshalDefinitions(definitions []Definition) ([]byte, error) {
+	return yaml.Marshal(map[string]interface{}{"definitions": definitions})
+}
+
+// unmarshalYAML is yaml.Unmarshal, but decodes numbers into interface{} values as
+// json.Number. Otherwise integers would be rendered as floats such as 1e+06 once marshaled
+// again, which can't be parsed back into an integer field.
+func unmarshalYAML(payload []byte, v interface{}) error {
+	payload, err := yaml.YAMLToJSON(payload)
+	if err != nil {
+		return err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(payload))
+	decoder.UseNumber()
+
+	return decoder.Decode(v)
+}
+
+// canonicalFields renames the fields of a definition to the names definitions files use
+// for the fields of its template. Fields are matched case-insensitively when parsed, so
+// without this a layer that wrote maxwait wouldn't replace the maxWait of another.
+// Fields that don't belong to the template are left as they are, as are the keys of maps
+// such as labels.
+func canonicalFields(template string, definition map[string]interface{}) map[string]interface{} {
+	tpl, ok := Templates[template]
+	if !ok || definition == nil {
+		return definition
+	}
+
+	return canonicalKeys(definition, reflect.TypeOf(tpl)).(map[string]interface{})
+}
+
+// canonicalKeys renames the keys of every map in the value that is unmarshaled into a
+// struct of the given type, recursing into the fields of the struct
+func canonicalKeys(value interface{}, typ reflect.Type) interface{} {
+	for typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+
+	if reflect.PtrTo(typ).Implements(reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()) {
+		return value
+	}
+
+	switch value := value.(type) {
+	case map[string]interface{}:
+		canonical := map[string]interface{}{}
+		for key, elem := range value {
+			switch typ.Kind() {
+			case reflect.Struct:
+				if field, ok := fieldByJSONName(typ, key); ok {
+					key, elem = jsonName(field), canonicalKeys(elem, field.Type)
+				}
+			case reflect.Map:
+				elem = canonicalKeys(elem, typ.Elem())
+			}
+
+			canonical[key] = elem
+		}
+
+		return canonical
+	case []interface{}:
+		if typ.Kind() != reflect.Slice {
+			return value
+		}
+
+		canonical := []interface{}{}
+		for _, elem := range value {
+			canonical = append(canonical, canonicalKeys(elem, typ.Elem()))
+		}
+
+		return canonical
+	}
+
+	return value
+}
+
+// fieldByJSONName finds the field of the struct, or of any struct it embeds, that
+// encoding/json would unmarshal the key into, preferring an exact match
+func fieldByJSONName(typ reflect.Type, key string) (reflect.StructField, bool) {
+	var folded *reflect.StructField
+	for _, field := range jsonFields(typ) {
+		if jsonName(field) == key {
+			return field, true
+		}
+
+		if strings.EqualFold(jsonName(field), key) && folded == nil {
+			field := field
+			folded = &field
+		}
+	}
+
+	if folded == nil {
+		return reflect.StructField{}, false
+	}
+
+	return *folded, true
+}
+
+// jsonFields lists the fields of the struct that encoding/json unmarshals into, including
+// those of embedded structs
+func jsonFields(typ reflect.Type) []reflect.StructField {
+	fields := []reflect.StructField{}
+	for idx := 0; idx < typ.NumField(); idx++ {
+		field := typ.Field(idx)
+		switch {
+		case field.Tag.Get("json") == "-":
+		case field.Anonymous && field.Type.Kind() == reflect.Struct && field.Tag.Get("json") == "":
+			fields = append(fields, jsonFields(field.Type)...)
+		case field.PkgPath == "":
+			fields = append(fields, field)
+		}
+	}
+
+	return fields
+}
+
+// jsonName is the name definitions files use for the field, which is the name from its
+// json tag or otherwise the name of the field starting in lower case, such as maxWait
+func jsonName(field reflect.StructField) string {
+	if name := strings.Split(field.Tag.Get("json"), ",")[0]; name != "" {
+		return name
+	}
+
+	return strings.ToLower(field.Name[:1]) + field.Name[1:]
+}
+
+// mergeDefinitions deep-merges each layer over the last, without modifying any of them
+func mergeDefinitions(layers ...map[string]interface{}) map[string]interface{} {
+	merged := map[string]interface{}{}
+	for _, layer := range layers {
+		for _, fields := range exclusiveFields {
+			for _, field := range fields {
+				if _, ok := layer[field]; !ok {
+					continue
+				}
+
+				for _, other := range fields {
+					if other != field {
+						delete(merged, other)
+					}
+				}
+			}
+		}
+
+		merged = mergeMaps(merged, layer)
+	}
+
+	return merged
+}
+
+// mergeMaps recursively merges the override into a copy of the base, where null values in
+// the override remove the field
+func mergeMaps(base, override map[string]interface{}) map[string]interface{} {
+	merged := map[string]interface{}{}
+	for key, value := range base {
+		merged[key] = value
+	}
+
+	for key, value := range override {
+		baseMap, baseIsMap := merged[key].(map[string]interface{})
+		overrideMap, overrideIsMap := value.(map[string]interface{})
+		switch {
+		case value == nil:
+			delete(merged, key)
+		case overrideIsMap && baseIsMap:
+			merged[key] = mergeMaps(baseMap, overrideMap)
+		case overrideIsMap:
+			merged[key] = mergeMaps(map[string]interface{}{}, overrideMap)
+		default:
+			merged[key] = value
+		}
+	}
+
+	return merged
+}
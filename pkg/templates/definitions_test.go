@@ -0,0 +1,364 @@
+package templates
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// definitionFields renders selected fields of each definition, so they can be compared
+// without depending on how numbers were decoded
+func definitionFields(definitions []Definition, fields ...string) []string {
+	rendered := []string{}
+	for _, definition := range definitions {
+		values := []string{definition.Template}
+		for _, field := range fields {
+			value, ok := definition.Definition[field]
+			if !ok {
+				values = append(values, field+"=<unset>")
+				continue
+			}
+
+			values = append(values, fmt.Sprintf("%s=%v", field, value))
+		}
+
+		rendered = append(rendered, strings.Join(values, " "))
+	}
+
+	return rendered
+}
+
+func assertDefinitions(t *testing.T, definitions []Definition, fields []string, expected ...string) {
+	t.Helper()
+
+	got := definitionFields(definitions, fields...)
+	if strings.Join(got, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("unexpected definitions\n  got:\n    %s\n  expected:\n    %s",
+			strings.Join(got, "\n    "), strings.Join(expected, "\n    "))
+	}
+}
+
+func TestResolveDefinitionsDefaults(t *testing.T) {
+	definitions, err := ResolveDefinitions([]byte(`
+defaults:
+  global:
+    budget: 0.001
+    labels:
+      channel: slo-alerts
+      team: payments
+  templates:
+    ErrorRateSLO:
+      dimensions: [namespace, release]
+definitions:
+  - template: ErrorRateSLO
+    definition:
+      name: A
+      labels:
+        team: mandates
+  - template: LatencySLO
+    definition:
+      name: B
+      objective: 99%
+      labels:
+        team: null
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertDefinitions(t, definitions, []string{"name", "budget", "objective", "labels", "dimensions"},
+		"ErrorRateSLO name=A budget=0.001 objective=<unset> labels=map[channel:slo-alerts team:mandates] dimensions=[namespace release]",
+		"LatencySLO name=B budget=<unset> objective=99% labels=map[channel:slo-alerts] dimensions=<unset>",
+	)
+}
+
+func TestResolveDefinitionsFieldCase(t *testing.T) {
+	definitions, err := ResolveDefinitions([]byte(`
+defaults:
+  global:
+    Budget: 0.001
+    labels: {Team: payments}
+    schedule: {Start: "09:00", end: "17:30"}
+  templates:
+    QueueLatencySLO:
+      maxwait: 5m
+definitions:
+  - template: QueueLatencySLO
+    definition:
+      name: A
+      objective: 99%
+      MaxWait: 10m
+      labels: {team: mandates}
+      schedule: {start: "10:00"}
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Fields are merged whatever their case, while the keys of labels are kept as written
+	assertDefinitions(t, definitions, []string{"budget", "Budget", "objective", "maxWait", "MaxWait", "maxwait", "labels", "schedule"},
+		"QueueLatencySLO budget=<unset> Budget=<unset> objective=99% maxWait=10m MaxWait=<unset> maxwait=<unset> labels=map[Team:payments team:mandates] schedule=map[end:17:30 start:10:00]",
+	)
+
+	patched, err := ApplyOverlay(definitions, []byte(`
+patches:
+  - name: A
+    definition:
+      MAXWAIT: 1m
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertDefinitions(t, patched, []string{"maxWait", "MAXWAIT"}, "QueueLatencySLO maxWait=1m MAXWAIT=<unset>")
+
+	if _, err := ApplyOverlay(definitions, []byte(`patches: [{name: A, definition: {Name: C}}]`)); err == nil {
+		t.Errorf("expected patch renaming the definition to fail")
+	}
+}
+
+func TestResolveDefinitionsUnknownTemplateDefaults(t *testing.T) {
+	_, err := ResolveDefinitions([]byte(`
+defaults:
+  templates:
+    ErrorRateSLOs:
+      budget: 0.1
+`))
+	if err == nil || !strings.Contains(err.Error(), "unsupported template type: ErrorRateSLOs") {
+		t.Errorf("expected unsupported template error, got %v", err)
+	}
+}
+
+func TestResolveDefinitionsMatrix(t *testing.T) {
+	definitions, err := ResolveDefinitions([]byte(`
+defaults:
+  global:
+    selector: '{app="${app}"}'
+definitions:
+  - template: ErrorRateSLO
+    matrix:
+      - service: Payments
+        app: payments-service
+        budget: 0.001
+        dimensions: [namespace]
+      - service: Mandates
+        app: mandates-service
+        budget: 0.01
+        dimensions: [release]
+    definition:
+      name: ${service}Errors
+      budget: ${budget}
+      dimensions: ${dimensions}
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertDefinitions(t, definitions, []string{"name", "budget", "selector", "dimensions"},
+		`ErrorRateSLO name=PaymentsErrors budget=0.001 selector={app="payments-service"} dimensions=[namespace]`,
+		`ErrorRateSLO name=MandatesErrors budget=0.01 selector={app="mandates-service"} dimensions=[release]`,
+	)
+}
+
+func TestResolveDefinitionsMatrixErrors(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		payload string
+		err     string
+	}{
+		{
+			name: "undefined variable",
+			payload: `
+definitions:
+  - template: ErrorRateSLO
+    matrix: [{service: a}]
+    definition: {name: "${service}${missing}"}
+`,
+			err: "undefined reference ${missing}",
+		},
+		{
+			name: "duplicate name",
+			payload: `
+definitions:
+  - template: ErrorRateSLO
+    matrix: [{service: a, budget: 0.1}, {service: a, budget: 0.2}]
+    definition: {name: "${service}"}
+`,
+			err: "entries 0 and 1 both expand to the name a",
+		},
+		{
+			name: "duplicate name across definitions",
+			payload: `
+definitions:
+  - template: ErrorRateSLO
+    definition: {name: a}
+  - template: LatencySLO
+    matrix: [{service: b}, {service: a}]
+    definition: {name: "${service}"}
+`,
+			err: "more than one definition has the name a",
+		},
+		{
+			name: "empty matrix",
+			payload: `
+definitions:
+  - template: ErrorRateSLO
+    matrix: []
+    definition: {name: a}
+`,
+			err: "matrix must have at least one entry",
+		},
+		{
+			name: "list in string",
+			payload: `
+definitions:
+  - template: ErrorRateSLO
+    matrix: [{labels: [a, b]}]
+    definition: {name: "x${labels}"}
+`,
+			err: "variable labels can't be formatted",
+		},
+	} {
+		_, err := ResolveDefinitions([]byte(tc.payload))
+		if err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Errorf("%s: expected error containing %q, got %v", tc.name, tc.err, err)
+		}
+	}
+}
+
+func TestResolveDefinitionsFragments(t *testing.T) {
+	definitions, err := ResolveDefinitions([]byte(`
+fragments:
+  search: ${app}, handler=~"Search"
+  app: app="payments-service"
+definitions:
+  - template: ErrorRateSLO
+    definition:
+      name: Search
+      errors: sum(rate(requests_total{${search}, status=~"5.."}[%s]))
+      total: sum(rate(requests_total{${search}}[%s]))
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertDefinitions(t, definitions, []string{"errors", "total"},
+		`ErrorRateSLO errors=sum(rate(requests_total{app="payments-service", handler=~"Search", status=~"5.."}[%s])) total=sum(rate(requests_total{app="payments-service", handler=~"Search"}[%s]))`,
+	)
+
+	// Fragments are substituted into the values of a matrix before it is expanded
+	definitions, err = ResolveDefinitions([]byte(`
+fragments:
+  payments: app="payments-service"
+  mandates: app="mandates-service"
+definitions:
+  - template: ErrorRateSLO
+    matrix:
+      - {service: Payments, selector: "${payments}"}
+      - {service: Mandates, selector: "${mandates}, handler!=\"Health\""}
+    definition:
+      name: ${service}Errors
+      errors: sum(rate(requests_total{${selector}, status=~"5.."}[%s]))
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertDefinitions(t, definitions, []string{"name", "errors"},
+		`ErrorRateSLO name=PaymentsErrors errors=sum(rate(requests_total{app="payments-service", status=~"5.."}[%s]))`,
+		`ErrorRateSLO name=MandatesErrors errors=sum(rate(requests_total{app="mandates-service", handler!="Health", status=~"5.."}[%s]))`,
+	)
+
+	for _, tc := range []struct {
+		name    string
+		payload string
+		err     string
+	}{
+		{
+			name: "variable in matrix value",
+			payload: `
+definitions:
+  - template: ErrorRateSLO
+    matrix: [{app: a, selector: "app=\"${app}\""}]
+    definition: {name: "${app}", errors: "sum(rate(x{${selector}}[%s]))"}
+`,
+			err: "entry 0: undefined reference ${app}",
+		},
+		{
+			name: "undefined fragment",
+			payload: `
+definitions:
+  - template: ErrorRateSLO
+    definition: {name: A, errors: "sum(rate(x{${missing}}[%s]))"}
+`,
+			err: "undefined reference ${missing}",
+		},
+		{
+			name: "cycle",
+			payload: `
+fragments: {a: "${b}", b: "${a}"}
+definitions: []
+`,
+			err: "fragments reference each other in a cycle: a -> b -> a",
+		},
+	} {
+		_, err := ResolveDefinitions([]byte(tc.payload))
+		if err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Errorf("%s: expected error containing %q, got %v", tc.name, tc.err, err)
+		}
+	}
+}
+
+func TestApplyOverlay(t *testing.T) {
+	definitions, err := ResolveDefinitions([]byte(`
+definitions:
+  - template: ErrorRateSLO
+    definition:
+      name: A
+      budget: 0.001
+      labels: {channel: slo-alerts, team: payments}
+  - template: ErrorRateSLO
+    definition:
+      name: B
+      budget: 0.001
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	patched, err := ApplyOverlay(definitions, []byte(`
+patches:
+  - name: A
+    definition:
+      objective: 99%
+      labels: {channel: production}
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fields := []string{"name", "budget", "objective", "labels"}
+	assertDefinitions(t, patched, fields,
+		"ErrorRateSLO name=A budget=<unset> objective=99% labels=map[channel:production team:payments]",
+		"ErrorRateSLO name=B budget=0.001 objective=<unset> labels=<unset>",
+	)
+
+	// The overlay must not modify the definitions it was given
+	assertDefinitions(t, definitions, fields,
+		"ErrorRateSLO name=A budget=0.001 objective=<unset> labels=map[channel:slo-alerts team:payments]",
+		"ErrorRateSLO name=B budget=0.001 objective=<unset> labels=<unset>",
+	)
+
+	for _, tc := range []struct {
+		overlay string
+		err     string
+	}{
+		{`patches: [{name: C, definition: {budget: 0.1}}]`, "patch for C doesn't match any definition"},
+		{`patches: [{name: A, definition: {name: C}}]`, "patch for A can't rename the definition"},
+	} {
+		_, err := ApplyOverlay(definitions, []byte(tc.overlay))
+		if err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Errorf("expected error containing %q, got %v", tc.err, err)
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package templates
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/prometheus/prometheus/pkg/rulefmt"
+)
+
+// SLOs that declare dimensions track a separate error ratio for every combination of the
+// dimension labels, such as one for each merchant or endpoint. Every expression in the
+// definition is aggregated by the dimensions, which then carry through the template rules
+// to the job:slo_error:ratio<I> series, and the alerts fire for each combination whose
+// error ratio burns through the budget.
+//
+// Dimensions can produce far more series than expected, so SLOs can limit them:
+//
+// - maxSeries stops tracking every combination once there are more than this many, and
+//   fires SLODimensionsOverLimit until the definition or the traffic is fixed. The SLO
+//   falls back to a single error ratio across every combination in the meantime.
+// - topk only tracks the combinations with the largest primary measure, such as the k
+//   endpoints receiving the most requests
+//
+// Both are measured from the primary expression of each template, which produces:
+//
+// - job:slo_dimensions:count{name}, the number of combinations
+// - job:slo_dimensions:max{name}, the maxSeries limit
+// - job:slo_dimensions:tracked{name, dimensions...}, each combination that is tracked
+//
+// Every other expression is then restricted to the tracked combinations.
+
+// dimensionsRankInterval is the window over which parameterized primary expressions are
+// measured to rank the dimensions
+var dimensionsRankInterval = "1h"
+
+// limited decides whether the dimensions of the SLO are restricted to those tracked
+func (b baseSLO) limited() bool {
+	return b.MaxSeries > 0 || b.TopK > 0
+}
+
+// aggregate ensures an expression produces one series for each combination of the SLO
+// dimensions, so that series from different expressions can be matched one-to-one and
+// the dimensions carry through to the error ratio. Expressions that don't aggregate are
+// aggregated with the given operator, and SLOs that don't declare dimensions leave their
+// expressions as they are.
+func (b baseSLO) aggregate(op, expr string) (string, error) {
+	if expr == "" || len(b.Dimensions) == 0 {
+		return expr, nil
+	}
+
+	aggregated, err := withDimensions(op, expr, b.Dimensions)
+	if err != nil || !b.limited() {
+		return aggregated, err
+	}
+
+	return b.limit(op, aggregated), nil
+}
+
+// limit restricts an expression aggregated by the dimensions to the tracked combinations.
+// Once there are more combinations than maxSeries, none of them are tracked, so the
+// expression is aggregated across every combination instead, keeping only the given
+// labels.
+func (b baseSLO) limit(op, aggregated string, keep ...string) string {
+	// The result may be composed into larger expressions where and would bind less
+	// tightly than intended
+	tracked := fmt.Sprintf(
+		"(%s\nand on(%s) job:slo_dimensions:tracked{name=\"%s\"})",
+		strings.TrimSpace(aggregated), strings.Join(b.Dimensions, ", "), b.Name,
+	)
+
+	if b.MaxSeries == 0 {
+		return tracked
+	}
+
+	return fmt.Sprintf(
+		"(\n%s\nor\n%s\nand on() (job:slo_dimensions:count{name=\"%s\"} > %d)\n)",
+		tracked, aggregateBy(op, keep, strings.TrimSpace(aggregated)), b.Name, b.MaxSeries,
+	)
+}
+
+// mustAggregate is aggregate for use when generating rules, where expressions have
+// already been checked with validateDimensions
+func (b baseSLO) mustAggregate(op, expr string) string {
+	aggregated, err := b.aggregate(op, expr)
+	if err != nil {
+		panic(fmt.Sprintf("invalid expression %s: %v", expr, err))
+	}
+
+	return aggregated
+}
+
+// validateDimensions checks that each expression can be aggregated to the SLO dimensions
+func (b baseSLO) validateDimensions(op string, exprs ...string) error {
+	for _, expr := range exprs {
+		if _, err := b.aggregate(op, expr); err != nil {
+			return fmt.Errorf("invalid expression %s: %v", expr, err)
+		}
+	}
+
+	return nil
+}
+
+// dimensionRules generates the rules that restrict the SLO to its tracked dimensions,
+// from the primary expression of the template. The primary expression must be ready for
+// use in a rule, and isn't itself restricted.
+func (b baseSLO) dimensionRules(op, primary string) []rulefmt.Rule {
+	if !b.limited() {
+		return []rulefmt.Rule{}
+	}
+
+	aggregated, err := withDimensions(op, primary, b.Dimensions)
+	if err != nil {
+		panic(fmt.Sprintf("invalid expression %s: %v", primary, err))
+	}
+
+	primary = aggregated
+	tracked := primary
+	if b.TopK > 0 {
+		tracked = fmt.Sprintf("topk(%d, %s)", b.TopK, primary)
+	}
+
+	rules := []rulefmt.Rule{
+		rulefmt.Rule{
+			Record: "job:slo_dimensions:count",
+			Labels: b.joinLabels(),
+			Expr:   fmt.Sprintf("count(%s)", primary),
+		},
+	}
+
+	if b.MaxSeries > 0 {
+		tracked = fmt.Sprintf(
+			"(%s)\nand on() (job:slo_dimensions:count{name=\"%s\"} <= %d)", tracked, b.Name, b.MaxSeries,
+		)
+
+		rules = append(rules, rulefmt.Rule{
+			Record: "job:slo_dimensions:max",
+			Labels: b.joinLabels(),
+			Expr:   fmt.Sprintf("%d", b.MaxSeries),
+		})
+	}
+
+	return append(rules, rulefmt.Rule{
+		Record: "job:slo_dimensions:tracked",
+		Labels: b.joinLabels(),
+		Expr:   tracked,
+	})
+}
+
+// dimensions returns the dimensions of the SLO, allowing SLOs that depend on others to
+// check theirs are compatible
+func (b baseSLO) dimensions() []string {
+	return b.Dimensions
+}
+
+// aggregateBy renders an aggregation of the expression by the labels, or across every
+// series if there are none
+func aggregateBy(op string, labels []string, expr string) string {
+	if len(labels) == 0 {
+		return fmt.Sprintf("%s(%s)", op, expr)
+	}
+
+	return fmt.Sprintf("%s by (%s) (%s)", op, strings.Join(labels, ", "), expr)
+}
+
+// atRankInterval prepares a parameterized primary expression for ranking the dimensions
+func atRankInterval(expr string) string {
+	rendered, err := atInterval(expr, dimensionsRankInterval)
+	if err != nil {
+		panic(fmt.Sprintf("invalid expression %s: %v", expr, err))
+	}
+
+	return rendered
+}
@@ -0,0 +1,39 @@
+package templates
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestMaxSeries(t *testing.T) {
+	slos := []SLO{}
+	for _, maxSeries := range []int{2, 3} {
+		slos = append(slos, mustParseSLO(t, "ErrorRateSLO", fmt.Sprintf(`
+name: Max%d
+budget: 0.01
+dimensions: [handler]
+maxSeries: %[1]d
+errors: rate(http_requests_total{status="500"}[5m])
+total: rate(http_requests_total[5m])
+`, maxSeries)))
+	}
+
+	test := evalSLOs(t, `
+load 1m
+  http_requests_total{handler="search", status="200"} 0+9x10
+  http_requests_total{handler="search", status="500"} 0+1x10
+  http_requests_total{handler="create", status="200"} 0+10x10
+  http_requests_total{handler="delete", status="200"} 0+20x10
+`, 10, slos...)
+	defer test.Close()
+
+	// Within the limit, each handler is tracked
+	test.assertValue(`job:slo_error:ratio5m{name="Max3", handler="search"}`, minute(10), 0.1)
+	test.assertValue(`job:slo_error:ratio5m{name="Max3", handler="create"}`, minute(10), 0)
+	test.assertValue(`count(job:slo_error:ratio5m{name="Max3"})`, minute(10), 3)
+
+	// Beyond the limit, only the aggregate across every handler remains
+	test.assertValue(`job:slo_dimensions:count{name="Max2"} > job:slo_dimensions:max{name="Max2"}`, minute(10), 3)
+	test.assertAbsent(`job:slo_dimensions:tracked{name="Max2"}`, minute(10))
+	test.assertValue(`job:slo_error:ratio5m{name="Max2"}`, minute(10), 0.025)
+}
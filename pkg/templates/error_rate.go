@@ -1,6 +1,8 @@
 package templates
 
 import (
+	"fmt"
+
 	"github.com/prometheus/prometheus/pkg/rulefmt"
 )
 
@@ -11,7 +13,9 @@ var (
 	ErrorRateTemplateRules = flattenRules(
 		// Calculate error rate ratio
 		// Worth noting that job:slo_error_rate_errors could be NaN so we
-		// need to ensure that it's 0 or a scalar
+		// need to ensure that it's 0 or a scalar. SLOs that declare their
+		// dimensions record both series with exactly the name and dimension
+		// labels, so they match one-to-one on(name, <dimensions>).
 		forIntervals(AlertWindows, rulefmt.Rule{
 			Record: "job:slo_error:ratio%s",
 			Expr:   `((job:slo_error_rate_errors:rate%[1]s) or (0 * job:slo_error_rate_total:rate%[1]s)) / job:slo_error_rate_total:rate%[1]s`,
@@ -25,32 +29,110 @@ func init() {
 
 // ErrorRateSLO is used to construct SLOs based on error rate.
 
-// To use this template, you provide a parameterised rate of requests and
-// errors that are sliced across multiple time windows.
+// To use this template, you provide a rate of requests and errors that are
+// sliced across multiple time windows, either parameterised with %s in place
+// of the window or as normal PromQL whose range selectors are rewritten.
+//
+// Alternatively, you can reference a preset for the metrics of a common
+// exporter, along with label matchers and grouping labels, and the rates of
+// requests and errors will be generated for you.
+//
+// Definitions can declare the dimensions of the SLI, such as namespace and
+// release, which are the only labels the recorded rates will have. Rates are
+// summed by the dimensions, unless they already aggregate by exactly those
+// labels, and any other top-level aggregation is an error. This ensures that
+// errors and total can't be silently mismatched.
+//
+// Definitions can also declare attribution labels, such as handler, to record
+// the share of errors from each handler and which handlers contribute most.
 type ErrorRateSLO struct {
 	baseSLO
-	Errors string
-	Total  string
+	presetRates
+	Errors      string
+	Total       string
+	Attribution attribution
+}
+
+func (e ErrorRateSLO) Validate() error {
+	if e.Preset == "" {
+		if e.Errors == "" || e.Total == "" {
+			return fmt.Errorf("errors and total must be provided, unless using a preset")
+		}
+
+		for _, expr := range []string{e.Errors, e.Total} {
+			if err := parseExpr(expr, "5m"); err != nil {
+				return fmt.Errorf("invalid expression %s: %v", expr, err)
+			}
+		}
+	} else {
+		if e.Errors != "" || e.Total != "" {
+			return fmt.Errorf("errors and total can't be provided alongside a preset")
+		}
+
+		preset, err := e.lookup()
+		if err != nil {
+			return err
+		}
+
+		if preset.Errors == "" || preset.Total == "" {
+			return fmt.Errorf("preset %s doesn't support error rates", e.Preset)
+		}
+	}
+
+	errors, total := e.expressions()
+	if err := e.validateExprs(errors, total); err != nil {
+		return err
+	}
+
+	if err := e.validateDimensions("sum", errors, total); err != nil {
+		return err
+	}
+
+	return e.Attribution.validate(e.baseSLO, errors)
 }
 
 func (e ErrorRateSLO) Rules() []rulefmt.Rule {
+	errors, total := e.expressions()
+	definition := map[string]string{
+		"template": "ErrorRateSLO",
+		"errors":   errors,
+		"total":    total,
+	}
+
+	if e.Preset != "" {
+		definition["preset"] = e.Preset
+	}
+
 	return flattenRules(
-		e.baseSLO.Rules(
-			map[string]string{
-				"template": "ErrorRateSLO",
-				"errors": e.Errors,
-				"total":  e.Total,
-			},
-		),
-		forIntervals(AlertWindows, rulefmt.Rule{
+		e.baseSLO.Rules(definition, e.Attribution.definition()),
+		e.dimensionRules("sum", atRankInterval(e.mustRender(total))),
+		e.forRateIntervals(AlertWindows, rulefmt.Rule{
 			Record: "job:slo_error_rate_errors:rate%s",
 			Labels: e.joinLabels(),
-			Expr:   e.Errors,
+			Expr:   e.mustAggregate("sum", e.mustRender(errors)),
 		}),
-		forIntervals(AlertWindows, rulefmt.Rule{
+		e.forRateIntervals(AlertWindows, rulefmt.Rule{
 			Record: "job:slo_error_rate_total:rate%s",
 			Labels: e.joinLabels(),
-			Expr:   e.Total,
+			Expr:   e.mustAggregate("sum", e.mustRender(total)),
 		}),
+		e.Attribution.rules(e.baseSLO, e.mustRender(errors)),
 	)
 }
+
+// expressions returns the rates of errors and total requests, generating them from the
+// preset if there is one. Preset rates are grouped by the dimensions of the SLO, unless
+// the definition groups them itself.
+func (e ErrorRateSLO) expressions() (string, string) {
+	if e.Preset == "" {
+		return e.Errors, e.Total
+	}
+
+	rates := e.presetRates
+	if len(rates.By) == 0 {
+		rates.By = e.Dimensions
+	}
+
+	preset, _ := rates.lookup()
+	return rates.rate(preset.Errors), rates.rate(preset.Total)
+}
@@ -0,0 +1,69 @@
+package templates
+
+import (
+	"testing"
+)
+
+func TestErrorRateSLO(t *testing.T) {
+	slo := mustParseSLO(t, "ErrorRateSLO", `
+name: Requests
+budget: 0.01
+errors: sum(rate(http_requests_total{status="500"}[5m]))
+total: sum(rate(http_requests_total[5m]))
+`)
+
+	test := evalSLOs(t, `
+load 1m
+  http_requests_total{status="200"} 0+19x10
+  http_requests_total{status="500"} 0+1x10
+`, 10, slo)
+	defer test.Close()
+
+	test.assertValue(`job:slo_error:ratio5m{name="Requests"}`, minute(10), 0.05)
+	test.assertValue(`job:slo_error_budget:ratio{name="Requests"}`, minute(10), 0.01)
+}
+
+func TestErrorRateSLODimensions(t *testing.T) {
+	slo := mustParseSLO(t, "ErrorRateSLO", `
+name: Requests
+budget: 0.01
+dimensions: [namespace]
+errors: rate(http_requests_total{status="500"}[5m])
+total: rate(http_requests_total[5m])
+`)
+
+	test := evalSLOs(t, `
+load 1m
+  http_requests_total{namespace="payments", pod="a", status="200"} 0+9x10
+  http_requests_total{namespace="payments", pod="b", status="500"} 0+1x10
+  http_requests_total{namespace="mandates", pod="c", status="200"} 0+10x10
+`, 10, slo)
+	defer test.Close()
+
+	test.assertValue(`job:slo_error:ratio5m{name="Requests", namespace="payments"}`, minute(10), 0.1)
+	test.assertValue(`job:slo_error:ratio5m{name="Requests", namespace="mandates"}`, minute(10), 0)
+}
+
+func TestErrorRateSLOValidate(t *testing.T) {
+	parseSLOError(t, "ErrorRateSLO", `
+name: Requests
+budget: 0.01
+errors: sum(rate(http_requests_total{status="500"}[5m]))
+`)
+
+	parseSLOError(t, "ErrorRateSLO", `
+name: Requests
+budget: 0.01
+objective: 0.99
+errors: sum(rate(http_requests_total{status="500"}[5m]))
+total: sum(rate(http_requests_total[5m]))
+`)
+
+	parseSLOError(t, "ErrorRateSLO", `
+name: Requests
+budget: 0.01
+dimensions: [namespace]
+errors: sum by (status) (rate(http_requests_total{status="500"}[5m])) > 0
+total: rate(http_requests_total[5m])
+`)
+}
@@ -0,0 +1,196 @@
+package templates
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/prometheus/prometheus/pkg/rulefmt"
+	"github.com/prometheus/prometheus/promql"
+)
+
+// Planned maintenance, such as a bank's scheduled downtime, shouldn't consume the error
+// budget of an SLO. Definitions can declare exclusions, either as an expression that is
+// positive while the SLO should be excluded, or as a calendar of time windows:
+//
+//	exclusions:
+//	  metric: max(bank_maintenance_active{scheme="bacs"})
+//	  windows:
+//	    - start: 2026-11-01T02:00:00Z
+//	      end: 2026-11-01T04:00:00Z
+//
+// These are compiled into job:slo_exclusion:active{name}, which is 1 while the SLO is
+// excluded and 0 otherwise. Templates that score each interval drop excluded intervals
+// from their error ratio, while templates that divide two rates measure each window from
+// the rates of the minutes in which the SLO wasn't excluded. The burn alerts never fire
+// for an SLO while it is excluded.
+
+// ExclusionResolution is the window over which rates are measured for SLOs with
+// exclusions, which are then summed over each of the evaluations that weren't excluded.
+// rate() needs at least two samples in its window, so this must span at least two
+// scrapes of the underlying metrics, or the SLO will have no error ratio at all.
+var ExclusionResolution = "5m"
+
+type exclusions struct {
+	Metric  string            `json:"metric"`  // expression that is positive while the SLO is excluded
+	Windows []exclusionWindow `json:"windows"` // time ranges in which the SLO is excluded
+}
+
+// exclusionWindow is a time range, which starts inclusive and ends exclusive
+type exclusionWindow struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+func (w exclusionWindow) String() string {
+	return fmt.Sprintf("%s/%s", w.Start.UTC().Format(time.RFC3339), w.End.UTC().Format(time.RFC3339))
+}
+
+// defined decides whether the SLO has any exclusions
+func (e exclusions) defined() bool {
+	return e.Metric != "" || len(e.Windows) > 0
+}
+
+func (e exclusions) validate() error {
+	if e.Metric != "" {
+		if _, err := promql.ParseExpr(e.Metric); err != nil {
+			return fmt.Errorf("invalid exclusion metric %s: %v", e.Metric, err)
+		}
+	}
+
+	for _, window := range e.Windows {
+		if window.Start.IsZero() || window.End.IsZero() {
+			return fmt.Errorf("exclusion windows must have a start and end")
+		}
+
+		if !window.End.After(window.Start) {
+			return fmt.Errorf("exclusion window %s must end after it starts", window)
+		}
+	}
+
+	return nil
+}
+
+// definition records the exclusions in the labels of job:slo_definition:none
+func (e exclusions) definition() map[string]string {
+	definition := map[string]string{}
+	if e.Metric != "" {
+		definition["exclusion_metric"] = e.Metric
+	}
+
+	if len(e.Windows) > 0 {
+		windows := []string{}
+		for _, window := range e.Windows {
+			windows = append(windows, window.String())
+		}
+
+		definition["exclusion_windows"] = strings.Join(windows, ", ")
+	}
+
+	return definition
+}
+
+// parts produces an expression for the metric and for the windows, each of which is
+// positive while the SLO is excluded. The metric is used as it was written, as
+// maintenance is often signalled from outside the system the SLO measures. The windows
+// are shifted by the delay of the SLO, like the data they exclude.
+func (e exclusions) parts(delay time.Duration) []string {
+	parts := []string{}
+	if e.Metric != "" {
+		parts = append(parts, fmt.Sprintf("(max((%s) > bool 0) or vector(0))", e.Metric))
+	}
+
+	if len(e.Windows) > 0 {
+		windows := []string{}
+		for _, window := range e.Windows {
+			windows = append(windows, fmt.Sprintf(
+				"(%[1]s >= bool %[2]d) * (%[1]s < bool %[3]d)", evaluationTime(delay), window.Start.Unix(), window.End.Unix(),
+			))
+		}
+
+		parts = append(parts, fmt.Sprintf("vector(\n  %s\n)", strings.Join(windows, "\n  + ")))
+	}
+
+	return parts
+}
+
+// excluded decides whether the SLO is ever excluded, either by its exclusions or by being
+// outside of its schedule
+func (b baseSLO) excluded() bool {
+	return b.Exclusions.defined() || b.Schedule.defined()
+}
+
+// exclusionRules generates job:slo_exclusion:active for SLOs that are ever excluded, which
+// is 1 while the SLO is excluded and 0 otherwise
+func (b baseSLO) exclusionRules() []rulefmt.Rule {
+	if !b.excluded() {
+		return []rulefmt.Rule{}
+	}
+
+	parts := b.Exclusions.parts(time.Duration(b.Delay))
+	if b.Schedule.defined() {
+		parts = append(parts, fmt.Sprintf(`max(job:slo_schedule_open:bool{name="%s"} == bool 0)`, b.Name))
+	}
+
+	expr := strings.Join(parts, "\n+\n")
+	if len(parts) > 1 || len(b.Exclusions.Windows) > 1 {
+		expr = fmt.Sprintf("clamp_max(\n  %s,\n  1\n)", strings.Replace(expr, "\n", "\n  ", -1))
+	}
+
+	return []rulefmt.Rule{
+		rulefmt.Rule{
+			Record: "job:slo_exclusion:active",
+			Labels: b.joinLabels(),
+			Expr:   expr,
+		},
+	}
+}
+
+// forRateIntervals is forExprIntervals for the rates that templates divide to produce
+// their error ratio. When the SLO has exclusions, the rate over the ExclusionResolution is
+// only recorded while the SLO isn't excluded. Every other window sums the recorded rates,
+// and divides by the number of evaluations in the window, so it remains a rate in which
+// the excluded evaluations count as zero. This reads the samples that were already
+// recorded, rather than evaluating the exclusions again for every minute of every window.
+// The rates recorded just after an exclusion ends still cover some of the excluded time,
+// for up to the ExclusionResolution.
+func (b baseSLO) forRateIntervals(intervals []string, rule rulefmt.Rule) []rulefmt.Rule {
+	if !b.excluded() {
+		return forExprIntervals(intervals, rule)
+	}
+
+	rules := forExprIntervals([]string{ExclusionResolution}, rule)
+	for idx := range rules {
+		rules[idx].Expr = fmt.Sprintf(
+			"(\n  %s\n)\nunless on() (job:slo_exclusion:active{name=\"%s\"} > 0)",
+			strings.Replace(strings.TrimSpace(rules[idx].Expr), "\n", "\n  ", -1), b.Name,
+		)
+	}
+
+	for _, interval := range intervals {
+		if interval == ExclusionResolution {
+			continue
+		}
+
+		rules = append(rules, rulefmt.Rule{
+			Record: fmt.Sprintf(rule.Record, interval),
+			Labels: rule.Labels,
+			Expr: fmt.Sprintf(
+				`sum_over_time(%[1]s{name="%[2]s"}[%[3]s])
+  / on(name) group_left() count_over_time(job:slo_exclusion:active{name="%[2]s"}[%[3]s])`,
+				fmt.Sprintf(rule.Record, ExclusionResolution), b.Name, interval,
+			),
+		})
+	}
+
+	return rules
+}
+
+// unlessExcluded drops the samples of a template's interval series while the SLO is
+// excluded, so they don't contribute to its error ratio
+func unlessExcluded(expr string) string {
+	return fmt.Sprintf(
+		"(\n  %s\n)\nunless on(name) (job:slo_exclusion:active > 0)",
+		strings.Replace(strings.TrimSpace(expr), "\n", "\n  ", -1),
+	)
+}
@@ -0,0 +1,106 @@
+package templates
+
+import (
+	"testing"
+)
+
+// withExclusionResolution overrides the ExclusionResolution until the returned function is
+// called
+func withExclusionResolution(resolution string) func() {
+	previous := ExclusionResolution
+	ExclusionResolution = resolution
+
+	return func() { ExclusionResolution = previous }
+}
+
+func TestExclusionWindows(t *testing.T) {
+	// A resolution as short as the interval between samples keeps every excluded error out
+	// of the recorded rates
+	defer withExclusionResolution("1m")()
+
+	slo := mustParseSLO(t, "ErrorRateSLO", `
+name: Requests
+budget: 0.01
+errors: sum(rate(http_requests_total{status="500"}[5m]))
+total: sum(rate(http_requests_total[5m]))
+exclusions:
+  windows:
+    - start: 1970-01-01T00:05:00Z
+      end: 1970-01-01T00:10:00Z
+`)
+
+	// Every error happens during the maintenance window
+	test := evalSLOs(t, `
+load 1m
+  http_requests_total{status="200"} 0+10x20
+  http_requests_total{status="500"} 0 0 0 0 0 0 6 12 18 24 24+0x10
+`, 20, slo)
+	defer test.Close()
+
+	test.assertValue(`job:slo_exclusion:active{name="Requests"}`, minute(7), 1)
+	test.assertAbsent(`job:slo_error_rate_errors:rate1m{name="Requests"}`, minute(7))
+	test.assertValue(`job:slo_error_rate_total:rate1m{name="Requests"}`, minute(12), 1.0/6)
+
+	// 15 of the 21 evaluations recorded the total rate, from 1m to 4m and from 10m
+	test.assertValue(`job:slo_error_rate_total:rate30m{name="Requests"}`, minute(20), 15.0/6/21)
+	test.assertValue(`job:slo_error:ratio30m{name="Requests"}`, minute(20), 0)
+}
+
+func TestExclusionWindowsDelay(t *testing.T) {
+	slo := mustParseSLO(t, "ErrorRateSLO", `
+name: Requests
+budget: 0.01
+delay: 2m
+errors: sum(rate(http_requests_total{status="500"}[5m]))
+total: sum(rate(http_requests_total[5m]))
+exclusions:
+  windows:
+    - start: 1970-01-01T00:05:00Z
+      end: 1970-01-01T00:10:00Z
+`)
+
+	test := evalSLOs(t, `
+load 1m
+  http_requests_total{status="200"} 0+10x20
+`, 20, slo)
+	defer test.Close()
+
+	// The window applies to the data it covers, which is recorded 2m later
+	for minutes, expected := range map[int]float64{6: 0, 7: 1, 11: 1, 12: 0} {
+		test.assertValue(`job:slo_exclusion:active{name="Requests"}`, minute(minutes), expected)
+	}
+}
+
+func TestExclusionResolution(t *testing.T) {
+	definition := `
+name: Requests
+budget: 0.01
+errors: sum(rate(http_requests_total{status="500"}[5m]))
+total: sum(rate(http_requests_total[5m]))
+exclusions:
+  metric: max(maintenance_active)
+`
+
+	// Samples are scraped every 2m, so a 1m rate never has the two samples it needs
+	load := `
+load 2m
+  http_requests_total{status="200"} 0+18x15
+  http_requests_total{status="500"} 0+2x15
+  maintenance_active 0+0x15
+`
+
+	slo := mustParseSLO(t, "ErrorRateSLO", definition)
+	test := evalSLOs(t, load, 30, slo)
+	defer test.Close()
+
+	test.assertValue(`job:slo_error:ratio30m{name="Requests"}`, minute(30), 0.1)
+	test.assertValue(`job:slo_error:ratio1m{name="Requests"}`, minute(30), 0.1)
+
+	defer withExclusionResolution("1m")()
+
+	slo = mustParseSLO(t, "ErrorRateSLO", definition)
+	short := evalSLOs(t, load, 30, slo)
+	defer short.Close()
+
+	short.assertAbsent(`job:slo_error:ratio30m{name="Requests"}`, minute(30))
+}
@@ -0,0 +1,427 @@
+package templates
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/pkg/rulefmt"
+	"github.com/prometheus/prometheus/promql"
+)
+
+// Templates that are measured over each alert window accept expressions in one of two
+// forms. The original form is parameterized with %s where the window should go:
+//
+//	sum by (namespace, release) (rate(http_request_duration_seconds_count{status=~"5.."}[%s]))
+//
+// Alternatively, expressions can be written as normal PromQL:
+//
+//	sum by (namespace, release) (rate(http_request_duration_seconds_count{status=~"5.."}[5m]))
+//
+// which we parse, then rewrite the range of every range selector to match each alert
+// window. Any values that would otherwise be formatted into the expression, such as the
+// le label of a histogram bucket, are added to the selectors as label matchers instead.
+
+// isParameterized decides whether an expression uses %s placeholders, by parsing it and
+// looking for placeholders in the range of range selectors, in label matchers and in
+// strings. Expressions that can't be parsed aren't parameterized, so their errors are
+// reported as they were written.
+func isParameterized(expr string) bool {
+	parsed, placeholders, err := parsePlaceholders(expr)
+	if err != nil {
+		return false
+	}
+
+	if len(placeholders) > 0 {
+		return true
+	}
+
+	var parameterized bool
+	promql.Inspect(parsed, func(node promql.Node, _ []promql.Node) error {
+		var values []string
+		switch node := node.(type) {
+		case *promql.VectorSelector:
+			values = matcherValues(node.LabelMatchers)
+		case *promql.MatrixSelector:
+			values = matcherValues(node.LabelMatchers)
+		case *promql.StringLiteral:
+			values = []string{node.Val}
+		}
+
+		for _, value := range values {
+			if placeholder.MatchString(value) {
+				parameterized = true
+			}
+		}
+
+		return nil
+	})
+
+	return parameterized
+}
+
+func matcherValues(matchers []*labels.Matcher) []string {
+	values := []string{}
+	for _, matcher := range matchers {
+		values = append(values, matcher.Value)
+	}
+
+	return values
+}
+
+// parseExpr checks that a user provided expression is valid PromQL, substituting the
+// given values for any placeholders
+func parseExpr(expr string, placeholders ...interface{}) error {
+	if isParameterized(expr) {
+		expr = fmt.Sprintf(expr, placeholders...)
+	}
+
+	_, err := promql.ParseExpr(expr)
+	return err
+}
+
+// forExprIntervals is the equivalent of forIntervals for a Rule with a user provided
+// expression, which may be either parameterized or normal PromQL
+func forExprIntervals(intervals []string, rule rulefmt.Rule) []rulefmt.Rule {
+	if isParameterized(rule.Expr) {
+		return forIntervals(intervals, rule)
+	}
+
+	rules := []rulefmt.Rule{}
+	for _, interval := range intervals {
+		expr, err := atInterval(rule.Expr, interval)
+		if err != nil {
+			panic(fmt.Sprintf("invalid expression %s: %v", rule.Expr, err))
+		}
+
+		rules = append(
+			rules,
+			rulefmt.Rule{
+				Record: fmt.Sprintf(rule.Record, interval),
+				Expr:   expr,
+				Labels: rule.Labels,
+			},
+		)
+	}
+
+	return rules
+}
+
+// atInterval renders a user provided expression for a single interval, whether it's
+// parameterized or normal PromQL
+func atInterval(expr, interval string) (string, error) {
+	if isParameterized(expr) {
+		return fmt.Sprintf(expr, interval), nil
+	}
+
+	return withRange(expr, interval)
+}
+
+// withRange rewrites the range of every range selector and subquery in the expression to
+// cover the given interval. The expression within a subquery is evaluated at each step of
+// the subquery, so its ranges decide what each step measures rather than the window the
+// subquery covers, and are left as they are.
+func withRange(expr, interval string) (string, error) {
+	window, err := model.ParseDuration(interval)
+	if err != nil {
+		return "", err
+	}
+
+	return rewriteExpr(expr, func(node promql.Node, path []promql.Node) error {
+		if withinSubquery(path) {
+			return nil
+		}
+
+		switch node := node.(type) {
+		case *promql.MatrixSelector:
+			node.Range = time.Duration(window)
+		case *promql.SubqueryExpr:
+			node.Range = time.Duration(window)
+		}
+
+		return nil
+	})
+}
+
+func withinSubquery(path []promql.Node) bool {
+	for _, node := range path {
+		if _, ok := node.(*promql.SubqueryExpr); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// withMatchers adds the label matchers to every selector in the expression. Selectors that
+// already match on one of the labels must do so identically, or we would silently change
+// which series they select.
+func withMatchers(expr string, matchers ...*labels.Matcher) (string, error) {
+	return rewriteExpr(expr, func(node promql.Node, _ []promql.Node) error {
+		var selectorMatchers *[]*labels.Matcher
+		switch selector := node.(type) {
+		case *promql.VectorSelector:
+			selectorMatchers = &selector.LabelMatchers
+		case *promql.MatrixSelector:
+			selectorMatchers = &selector.LabelMatchers
+		default:
+			return nil
+		}
+
+	matchers:
+		for _, matcher := range matchers {
+			for _, existing := range *selectorMatchers {
+				if existing.Name != matcher.Name {
+					continue
+				}
+
+				if existing.String() != matcher.String() {
+					return fmt.Errorf("selector %s conflicts with matcher %s", node, matcher)
+				}
+
+				continue matchers
+			}
+
+			*selectorMatchers = append(*selectorMatchers, matcher)
+		}
+
+		return nil
+	})
+}
+
+// withOffset shifts every selector in the expression back by the given delay, in addition
+// to any offset it already has. Subqueries are shifted by the selectors within them.
+func withOffset(expr string, delay time.Duration) (string, error) {
+	return rewriteExpr(expr, func(node promql.Node, _ []promql.Node) error {
+		switch selector := node.(type) {
+		case *promql.VectorSelector:
+			selector.Offset += delay
+		case *promql.MatrixSelector:
+			selector.Offset += delay
+		}
+
+		return nil
+	})
+}
+
+func equalMatcher(name, value string) *labels.Matcher {
+	return &labels.Matcher{Type: labels.MatchEqual, Name: name, Value: value}
+}
+
+// placeholder matches a %s placeholder, including explicit argument indexes such as %[1]s
+var placeholder = regexp.MustCompile(`%(\[\d+\])?s`)
+
+// placeholderRange matches the range of a parameterized range selector, such as [%s]
+var placeholderRange = regexp.MustCompile(`\[\s*%(\[\d+\])?s\s*\]`)
+
+// parsePlaceholders parses an expression that may be parameterized. Placeholder ranges
+// can't be parsed as they are, so each is swapped for a distinct sentinel duration before
+// parsing, and returned by the sentinel so they can be restored afterwards. Placeholders
+// in label values are valid PromQL strings, so are left alone.
+func parsePlaceholders(expr string) (promql.Expr, map[string]string, error) {
+	placeholders := map[string]string{}
+	expr = placeholderRange.ReplaceAllStringFunc(expr, func(placeholder string) string {
+		sentinel := fmt.Sprintf("[%ds]", placeholderSentinel+len(placeholders))
+		placeholders[sentinel] = placeholder
+		return sentinel
+	})
+
+	parsed, err := promql.ParseExpr(expr)
+	return parsed, placeholders, err
+}
+
+// rewriteExpr parses the expression, calls rewrite for every node and renders the result,
+// restoring any placeholders. The PromQL printer drops the offset of a subquery, so
+// expressions with one are rejected rather than silently changed.
+func rewriteExpr(expr string, rewrite func(promql.Node, []promql.Node) error) (string, error) {
+	parsed, placeholders, err := parsePlaceholders(expr)
+	if err != nil {
+		return "", err
+	}
+
+	var rewriteErr error
+	promql.Inspect(parsed, func(node promql.Node, path []promql.Node) error {
+		if subquery, ok := node.(*promql.SubqueryExpr); ok && subquery.Offset != 0 && rewriteErr == nil {
+			rewriteErr = fmt.Errorf("subquery %s has an offset, which isn't supported", subquery)
+		}
+
+		if err := rewrite(node, path); err != nil && rewriteErr == nil {
+			rewriteErr = err
+		}
+
+		return nil
+	})
+
+	restore := func(rendered string) string {
+		for sentinel, placeholder := range placeholders {
+			rendered = strings.Replace(rendered, sentinel, placeholder, -1)
+		}
+
+		return rendered
+	}
+
+	if rewriteErr != nil {
+		return "", fmt.Errorf("%s", restore(rewriteErr.Error()))
+	}
+
+	return restore(parsed.String()), nil
+}
+
+// placeholderSentinel is an unlikely range in seconds, that isn't a whole number of
+// minutes so renders back to the same value
+const placeholderSentinel = 987654301
+
+// withDimensions ensures the expression produces series labelled with exactly the given
+// dimensions. An expression that aggregates at the top level must already group by the
+// dimensions, as we can't know whether re-aggregating its result would be correct, while
+// any other expression is aggregated by them with the given operator. That includes
+// expressions that aggregate below the top level, such as sum by (status) (...) > 0,
+// whose labels we can't extend, so those are rejected.
+func withDimensions(op, expr string, dimensions []string) (string, error) {
+	var aggregated bool
+	var nested *promql.AggregateExpr
+	rendered, err := rewriteExpr(expr, func(node promql.Node, path []promql.Node) error {
+		aggregation, ok := node.(*promql.AggregateExpr)
+		if !ok {
+			return nil
+		}
+
+		if !topLevel(path) {
+			if nested == nil {
+				nested = aggregation
+			}
+
+			return nil
+		}
+
+		aggregated = true
+		if aggregation.Without {
+			return fmt.Errorf("aggregates without (%s), but must aggregate by the dimensions (%s)",
+				strings.Join(aggregation.Grouping, ", "), strings.Join(dimensions, ", "))
+		}
+
+		if !sameLabels(aggregation.Grouping, dimensions) {
+			return fmt.Errorf("aggregates by (%s), which doesn't match the dimensions (%s)",
+				strings.Join(aggregation.Grouping, ", "), strings.Join(dimensions, ", "))
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return "", err
+	}
+
+	// Expressions that already aggregate by the dimensions are kept as they were written
+	if aggregated {
+		return expr, nil
+	}
+
+	if nested != nil {
+		return "", fmt.Errorf(
+			"aggregates with %s below the top level, so can't be aggregated by the dimensions (%s), "+
+				"aggregate by the dimensions at the top level instead",
+			describeAggregation(nested), strings.Join(dimensions, ", "),
+		)
+	}
+
+	return fmt.Sprintf("%s by (%s) (%s)", op, strings.Join(dimensions, ", "), rendered), nil
+}
+
+// topLevel decides whether a node with the given parents is the top level of the
+// expression, ignoring any parentheses around it
+func topLevel(path []promql.Node) bool {
+	for _, parent := range path {
+		if _, ok := parent.(*promql.ParenExpr); !ok {
+			return false
+		}
+	}
+
+	return true
+}
+
+// describeAggregation renders the operator and grouping of an aggregation, such as
+// sum by (status)
+func describeAggregation(aggregation *promql.AggregateExpr) string {
+	switch {
+	case aggregation.Without:
+		return fmt.Sprintf("%s without (%s)", aggregation.Op, strings.Join(aggregation.Grouping, ", "))
+	case len(aggregation.Grouping) > 0:
+		return fmt.Sprintf("%s by (%s)", aggregation.Op, strings.Join(aggregation.Grouping, ", "))
+	}
+
+	return aggregation.Op.String()
+}
+
+func sameLabels(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	sortedA := append([]string{}, a...)
+	sortedB := append([]string{}, b...)
+	sort.Strings(sortedA)
+	sort.Strings(sortedB)
+
+	for idx := range sortedA {
+		if sortedA[idx] != sortedB[idx] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// withAttribution breaks the result of the expression down by the given labels, by adding
+// them to the grouping of its top-level sum. Expressions that don't aggregate at the top
+// level are summed by the dimensions and the labels, which requires the dimensions to be
+// known, as otherwise the result wouldn't match the series of the original expression.
+func withAttribution(expr string, dimensions, labels []string) (string, error) {
+	var aggregated bool
+	var nested *promql.AggregateExpr
+	rendered, err := rewriteExpr(expr, func(node promql.Node, path []promql.Node) error {
+		aggregation, ok := node.(*promql.AggregateExpr)
+		if !ok {
+			return nil
+		}
+
+		if !topLevel(path) {
+			if nested == nil {
+				nested = aggregation
+			}
+
+			return nil
+		}
+
+		aggregated = true
+		if aggregation.Op != promql.ItemSum || aggregation.Without {
+			return fmt.Errorf("can only be attributed when summed by the labels to preserve")
+		}
+
+		aggregation.Grouping = append(aggregation.Grouping, labels...)
+		return nil
+	})
+
+	if err != nil || aggregated {
+		return rendered, err
+	}
+
+	if len(dimensions) == 0 {
+		return "", fmt.Errorf("can only be attributed when summed, or when the SLO has dimensions")
+	}
+
+	if nested != nil {
+		return "", fmt.Errorf(
+			"aggregates with %s below the top level, so can only be attributed when summed at the top level",
+			describeAggregation(nested),
+		)
+	}
+
+	return fmt.Sprintf(
+		"sum by (%s) (%s)", strings.Join(append(append([]string{}, dimensions...), labels...), ", "), rendered,
+	), nil
+}
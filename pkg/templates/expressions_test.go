@@ -0,0 +1,278 @@
+package templates
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/prometheus/pkg/rulefmt"
+)
+
+func TestIsParameterized(t *testing.T) {
+	for _, tc := range []struct {
+		expr     string
+		expected bool
+	}{
+		{`rate(http_requests_total[%s])`, true},
+		{`rate(http_requests_total{le="%[1]s"}[%[2]s])`, true},
+		{`rate(http_requests_total[5m])`, false},
+		{`max(http_request_duration_seconds{quantile="%s"})`, true},
+		{`label_replace(up, "percent", "100%s", "", "")`, true},
+		{`sum(rate(http_requests_total{path=~"/100%"}[5m]))`, false},
+		{`rate(http_requests_total[%s]`, false},
+	} {
+		if got := isParameterized(tc.expr); got != tc.expected {
+			t.Errorf("isParameterized(%s) = %v, expected %v", tc.expr, got, tc.expected)
+		}
+	}
+}
+
+func TestWithRange(t *testing.T) {
+	for _, tc := range []struct {
+		expr     string
+		interval string
+		expected string
+	}{
+		{
+			expr:     `rate(http_requests_total[5m])`,
+			interval: "1h",
+			expected: `rate(http_requests_total[1h])`,
+		},
+		{
+			expr:     `sum by (namespace) (rate(http_requests_total{status=~"5.."}[5m])) / sum by (namespace) (rate(http_requests_total[1m]))`,
+			interval: "30m",
+			expected: `sum by(namespace) (rate(http_requests_total{status=~"5.."}[30m])) / sum by(namespace) (rate(http_requests_total[30m]))`,
+		},
+		{
+			expr:     `increase(jobs_total[5m] offset 1m)`,
+			interval: "28d",
+			expected: `increase(jobs_total[4w] offset 1m)`,
+		},
+		{
+			expr:     `max_over_time(sum(rate(http_requests_total[1m]))[5m:30s])`,
+			interval: "1h",
+			expected: `max_over_time(sum(rate(http_requests_total[1m]))[1h:30s])`,
+		},
+		{
+			expr:     `max_over_time(max_over_time(rate(http_requests_total[1m])[10m:1m])[5m:1m]) / rate(up[5m])`,
+			interval: "1h",
+			expected: `max_over_time(max_over_time(rate(http_requests_total[1m])[10m:1m])[1h:1m]) / rate(up[1h])`,
+		},
+	} {
+		got, err := withRange(tc.expr, tc.interval)
+		if err != nil {
+			t.Errorf("withRange(%s, %s) failed: %v", tc.expr, tc.interval, err)
+			continue
+		}
+
+		if got != tc.expected {
+			t.Errorf("withRange(%s, %s)\n  got: %s\n  expected: %s", tc.expr, tc.interval, got, tc.expected)
+		}
+	}
+}
+
+func TestForExprIntervals(t *testing.T) {
+	for _, expr := range []string{`rate(http_requests_total[%s])`, `rate(http_requests_total[5m])`} {
+		rules := forExprIntervals([]string{"1m", "1h"}, rulefmt.Rule{Record: "job:test:rate%s", Expr: expr})
+		if len(rules) != 2 {
+			t.Fatalf("expected a rule for each interval, got %v", rules)
+		}
+
+		for idx, interval := range []string{"1m", "1h"} {
+			if rules[idx].Record != "job:test:rate"+interval {
+				t.Errorf("expected record job:test:rate%s, got %s", interval, rules[idx].Record)
+			}
+
+			if expected := "rate(http_requests_total[" + interval + "])"; rules[idx].Expr != expected {
+				t.Errorf("expected %s, got %s", expected, rules[idx].Expr)
+			}
+		}
+	}
+}
+
+func TestWithMatchers(t *testing.T) {
+	for _, tc := range []struct {
+		expr     string
+		expected string
+		err      string
+	}{
+		{
+			expr:     `sum(rate(http_requests_total[5m])) / sum(up)`,
+			expected: `sum(rate(http_requests_total{cluster="prod-eu"}[5m])) / sum(up{cluster="prod-eu"})`,
+		},
+		{
+			expr:     `rate(http_requests_total{cluster="prod-eu"}[%s])`,
+			expected: `rate(http_requests_total{cluster="prod-eu"}[%s])`,
+		},
+		{
+			expr:     `rate(http_requests_total{le="%s"}[%s])`,
+			expected: `rate(http_requests_total{cluster="prod-eu",le="%s"}[%s])`,
+		},
+		{
+			expr: `rate(http_requests_total{cluster="staging"}[5m])`,
+			err:  `conflicts with matcher cluster="prod-eu"`,
+		},
+	} {
+		got, err := withMatchers(tc.expr, equalMatcher("cluster", "prod-eu"))
+		if tc.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("withMatchers(%s) expected error containing %q, got %v", tc.expr, tc.err, err)
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("withMatchers(%s) failed: %v", tc.expr, err)
+			continue
+		}
+
+		if got != tc.expected {
+			t.Errorf("withMatchers(%s)\n  got: %s\n  expected: %s", tc.expr, got, tc.expected)
+		}
+	}
+}
+
+func TestWithOffset(t *testing.T) {
+	for _, tc := range []struct {
+		expr     string
+		expected string
+		err      string
+	}{
+		{
+			expr:     `sum(rate(http_requests_total[5m])) / sum(up)`,
+			expected: `sum(rate(http_requests_total[5m] offset 2m)) / sum(up offset 2m)`,
+		},
+		{
+			expr:     `rate(http_requests_total[%s] offset 1m)`,
+			expected: `rate(http_requests_total[%s] offset 3m)`,
+		},
+		{
+			expr:     `max_over_time(rate(http_requests_total[5m])[1h:1m])`,
+			expected: `max_over_time(rate(http_requests_total[5m] offset 2m)[1h:1m])`,
+		},
+		{
+			expr: `max_over_time(rate(http_requests_total[5m])[1h:1m] offset 1m)`,
+			err:  "has an offset, which isn't supported",
+		},
+	} {
+		got, err := withOffset(tc.expr, 2*time.Minute)
+		if tc.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("withOffset(%s) expected error containing %q, got %v", tc.expr, tc.err, err)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("withOffset(%s) failed: %v", tc.expr, err)
+			continue
+		}
+
+		if got != tc.expected {
+			t.Errorf("withOffset(%s)\n  got: %s\n  expected: %s", tc.expr, got, tc.expected)
+		}
+	}
+}
+
+func TestWithDimensions(t *testing.T) {
+	dimensions := []string{"namespace", "release"}
+	for _, tc := range []struct {
+		expr     string
+		expected string
+		err      string
+	}{
+		{
+			expr:     `rate(http_requests_total[%s])`,
+			expected: `sum by (namespace, release) (rate(http_requests_total[%s]))`,
+		},
+		{
+			expr:     `sum by (release, namespace) (rate(http_requests_total[5m]))`,
+			expected: `sum by (release, namespace) (rate(http_requests_total[5m]))`,
+		},
+		{
+			expr: `sum by (namespace) (rate(http_requests_total[5m]))`,
+			err:  `aggregates by (namespace), which doesn't match the dimensions (namespace, release)`,
+		},
+		{
+			expr: `sum without (instance) (rate(http_requests_total[5m]))`,
+			err:  `aggregates without (instance)`,
+		},
+		{
+			expr: `sum by (status) (rate(http_requests_total[5m])) > 0`,
+			err:  `aggregates with sum by (status) below the top level`,
+		},
+		{
+			expr:     `max by (namespace, release) (1.5 * max_over_time(sum by (namespace, release) (up)[1d:1h]))`,
+			expected: `max by (namespace, release) (1.5 * max_over_time(sum by (namespace, release) (up)[1d:1h]))`,
+		},
+	} {
+		got, err := withDimensions("sum", tc.expr, dimensions)
+		if tc.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("withDimensions(%s) expected error containing %q, got %v", tc.expr, tc.err, err)
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("withDimensions(%s) failed: %v", tc.expr, err)
+			continue
+		}
+
+		if got != tc.expected {
+			t.Errorf("withDimensions(%s)\n  got: %s\n  expected: %s", tc.expr, got, tc.expected)
+		}
+	}
+}
+
+func TestWithAttribution(t *testing.T) {
+	for _, tc := range []struct {
+		expr       string
+		dimensions []string
+		expected   string
+		err        string
+	}{
+		{
+			expr:     `sum by (namespace) (rate(http_requests_total[%s]))`,
+			expected: `sum by(namespace, handler) (rate(http_requests_total[%s]))`,
+		},
+		{
+			expr:       `rate(http_requests_total[%s])`,
+			dimensions: []string{"namespace"},
+			expected:   `sum by (namespace, handler) (rate(http_requests_total[%s]))`,
+		},
+		{
+			expr: `rate(http_requests_total[%s])`,
+			err:  `can only be attributed when summed, or when the SLO has dimensions`,
+		},
+		{
+			expr: `max by (namespace) (rate(http_requests_total[%s]))`,
+			err:  `can only be attributed when summed by the labels to preserve`,
+		},
+		{
+			expr:       `sum by (namespace) (rate(http_requests_total[%s])) > 0`,
+			dimensions: []string{"namespace"},
+			err:        `aggregates with sum by (namespace) below the top level`,
+		},
+	} {
+		got, err := withAttribution(tc.expr, tc.dimensions, []string{"handler"})
+		if tc.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("withAttribution(%s) expected error containing %q, got %v", tc.expr, tc.err, err)
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("withAttribution(%s) failed: %v", tc.expr, err)
+			continue
+		}
+
+		if got != tc.expected {
+			t.Errorf("withAttribution(%s)\n  got: %s\n  expected: %s", tc.expr, got, tc.expected)
+		}
+	}
+}
@@ -3,10 +3,11 @@ package templates
 import (
 	"encoding/json"
 	"fmt"
+	"math/big"
 	"reflect"
+	"strings"
 	"time"
 
-	"github.com/ghodss/yaml"
 	"github.com/prometheus/common/model"
 	"github.com/prometheus/prometheus/pkg/rulefmt"
 )
@@ -61,6 +62,51 @@ func (d *serializeableDuration) UnmarshalJSON(payload []byte) error {
 	return err
 }
 
+// serializeableRatio supports unmarshaling a ratio from JSON as either a number, such as
+// 0.999, or a percentage, such as "99.9%". The value is stored exactly, so can be
+// rendered without the rounding of a float.
+type serializeableRatio struct {
+	*big.Rat
+}
+
+func (r *serializeableRatio) UnmarshalJSON(payload []byte) error {
+	var human string
+	if err := json.Unmarshal(payload, &human); err != nil {
+		human = string(payload)
+	}
+
+	human = strings.TrimSpace(human)
+	percentage := strings.HasSuffix(human, "%")
+
+	parsed, ok := new(big.Rat).SetString(strings.TrimSpace(strings.TrimSuffix(human, "%")))
+	if !ok {
+		return fmt.Errorf("invalid ratio %q, expected a number such as 0.999 or a percentage such as 99.9%%", human)
+	}
+
+	if percentage {
+		parsed.Quo(parsed, big.NewRat(100, 1))
+	}
+
+	r.Rat = parsed
+	return nil
+}
+
+// String renders the ratio as the shortest decimal that exactly represents it
+func (r serializeableRatio) String() string {
+	for precision := 0; precision < maxRatioPrecision; precision++ {
+		formatted := r.FloatString(precision)
+		if parsed, ok := new(big.Rat).SetString(formatted); ok && parsed.Cmp(r.Rat) == 0 {
+			return formatted
+		}
+	}
+
+	return r.FloatString(maxRatioPrecision)
+}
+
+// maxRatioPrecision bounds the decimal places of a rendered ratio, for ratios such as
+// 1/3 that have no exact decimal representation
+const maxRatioPrecision = 30
+
 // ParseDefinitions loads a YAML file of configured templates that looks like this:
 //
 //   ---
@@ -71,19 +117,21 @@ func (d *serializeableDuration) UnmarshalJSON(payload []byte) error {
 //         ...
 //
 // and produces a list of SLOs. This is the file format we expect users to be providing to
-// the slo-builder.
+// the slo-builder. Any defaults in the file are applied first, as in ResolveDefinitions.
 func ParseDefinitions(payload []byte) ([]SLO, error) {
-	envelope := struct {
-		Definitions []sloEnvelope `json:"definitions"`
-	}{}
-
-	if err := yaml.Unmarshal(payload, &envelope); err != nil {
+	definitions, err := ResolveDefinitions(payload)
+	if err != nil {
 		return nil, err
 	}
 
 	slos := []SLO{}
-	for _, sloEnvelope := range envelope.Definitions {
-		slos = append(slos, sloEnvelope.SLO)
+	for _, definition := range definitions {
+		slo, err := definition.SLO()
+		if err != nil {
+			return nil, err
+		}
+
+		slos = append(slos, slo)
 	}
 
 	return slos, nil
@@ -114,5 +162,21 @@ func (s *sloEnvelope) UnmarshalJSON(payload []byte) error {
 	// Initialise a new SLO from the registered concrete type
 	s.SLO = reflect.New(reflect.TypeOf(tpl)).Interface().(SLO)
 
-	return json.Unmarshal(envelope.Definition, s.SLO)
+	if err := json.Unmarshal(envelope.Definition, s.SLO); err != nil {
+		return err
+	}
+
+	if base, ok := s.SLO.(interface{ validateBase() error }); ok {
+		if err := base.validateBase(); err != nil {
+			return fmt.Errorf("invalid %s definition %s: %v", envelope.Template, s.SLO.GetName(), err)
+		}
+	}
+
+	if validator, ok := s.SLO.(validator); ok {
+		if err := validator.Validate(); err != nil {
+			return fmt.Errorf("invalid %s definition %s: %v", envelope.Template, s.SLO.GetName(), err)
+		}
+	}
+
+	return nil
 }
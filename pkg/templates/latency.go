@@ -30,37 +30,121 @@ func init() {
 // parameterized counter that tracks the number of observations (histogram
 // bucket) and request class that references a latency target.
 //
+// The observation is parameterized with the request class followed by the
+// window, or can be written as normal PromQL without an le matcher, in which
+// case le="<request class>" is added to every selector.
+//
+// As with ErrorRateSLO, definitions can declare the dimensions of the SLI,
+// which are the only labels the recorded rates will have.
+//
 // This template allows defining SLOs as follows:
 //
 // 90% requests < 300ms
 // 99% requests < 1000ms
 //
+// Alternatively, you can reference a preset for the metrics of a common
+// exporter, along with label matchers and grouping labels, and the rate of
+// total requests and histogram bucket will be generated for you.
+//
 type LatencySLO struct {
 	baseSLO
+	presetRates
 	RequestClass string // request class references a latency target
 	Total        string // parameterized rate of total requests
 	Observation  string // parameterized rate of histogram bucket
 }
 
+func (l LatencySLO) Validate() error {
+	if l.Preset == "" {
+		if l.Total == "" || l.Observation == "" {
+			return fmt.Errorf("total and observation must be provided, unless using a preset")
+		}
+
+		if err := parseExpr(l.Total, "5m"); err != nil {
+			return fmt.Errorf("invalid total %s: %v", l.Total, err)
+		}
+
+		if _, err := l.observation(); err != nil {
+			return fmt.Errorf("invalid observation %s: %v", l.Observation, err)
+		}
+	} else {
+		if l.Total != "" || l.Observation != "" {
+			return fmt.Errorf("total and observation can't be provided alongside a preset")
+		}
+
+		preset, err := l.lookup()
+		if err != nil {
+			return err
+		}
+
+		if preset.Buckets == "" || preset.Count == "" {
+			return fmt.Errorf("preset %s doesn't support latency", l.Preset)
+		}
+	}
+
+	total, observation := l.expressions()
+	if err := l.validateExprs(total, observation); err != nil {
+		return err
+	}
+
+	return l.validateDimensions("sum", total, observation)
+}
+
 func (l LatencySLO) Rules() []rulefmt.Rule {
+	definition := map[string]string{
+		"template":      "LatencySLO",
+		"request_class": l.RequestClass,
+		"total":         l.Total,
+		"observation":   l.Observation,
+	}
+
+	total, observation := l.expressions()
+	if l.Preset != "" {
+		definition["preset"] = l.Preset
+		definition["total"] = total
+		definition["observation"] = observation
+	}
+
 	return flattenRules(
-		l.baseSLO.Rules(
-			map[string]string{
-				"template":      "LatencySLO",
-				"request_class": l.RequestClass,
-				"total":         l.Total,
-				"observation":   l.Observation,
-			},
-		),
-		forIntervals(AlertWindows, rulefmt.Rule{
+		l.baseSLO.Rules(definition),
+		l.dimensionRules("sum", atRankInterval(l.mustRender(total))),
+		l.forRateIntervals(AlertWindows, rulefmt.Rule{
 			Record: "job:slo_latency_total:rate%s",
 			Labels: l.joinLabels(map[string]string{"request_class": l.RequestClass}),
-			Expr:   l.Total,
+			Expr:   l.mustAggregate("sum", l.mustRender(total)),
 		}),
-		forIntervals(AlertWindows, rulefmt.Rule{
+		l.forRateIntervals(AlertWindows, rulefmt.Rule{
 			Record: "job:slo_latency_observation:rate%s",
 			Labels: l.joinLabels(map[string]string{"request_class": l.RequestClass}),
-			Expr:   fmt.Sprintf(l.Observation, l.RequestClass, "%s"),
+			Expr:   l.mustAggregate("sum", l.mustRender(observation)),
 		}),
 	)
 }
+
+// expressions returns the rate of total requests and of the histogram bucket for the
+// request class, generating them from the preset if there is one. Preset rates are
+// grouped by the dimensions of the SLO, unless the definition groups them itself.
+func (l LatencySLO) expressions() (string, string) {
+	if l.Preset == "" {
+		observation, _ := l.observation()
+		return l.Total, observation
+	}
+
+	rates := l.presetRates
+	if len(rates.By) == 0 {
+		rates.By = l.Dimensions
+	}
+
+	preset, _ := rates.lookup()
+	return rates.rate(preset.Count), rates.rate(preset.Buckets, fmt.Sprintf(`le="%s"`, l.RequestClass))
+}
+
+// observation selects the histogram bucket for the request class, either by formatting it
+// into the parameterized observation or by adding an le matcher to every selector
+func (l LatencySLO) observation() (string, error) {
+	if isParameterized(l.Observation) {
+		return fmt.Sprintf(l.Observation, l.RequestClass, "%s"), parseExpr(l.Observation, l.RequestClass, "5m")
+	}
+
+	return withMatchers(l.Observation, equalMatcher("le", l.RequestClass))
+}
@@ -0,0 +1,44 @@
+package templates
+
+import (
+	"testing"
+)
+
+func TestLatencySLO(t *testing.T) {
+	preset := mustParseSLO(t, "LatencySLO", `
+name: Preset
+budget: 0.01
+requestClass: "0.5"
+preset: http_server_histogram
+selector: '{app="payments-service"}'
+`)
+
+	plain := mustParseSLO(t, "LatencySLO", `
+name: Plain
+budget: 0.01
+requestClass: "0.5"
+total: sum(rate(http_request_duration_seconds_count{app="payments-service"}[5m]))
+observation: sum(rate(http_request_duration_seconds_bucket{app="payments-service"}[5m]))
+`)
+
+	test := evalSLOs(t, `
+load 1m
+  http_request_duration_seconds_count{app="payments-service"} 0+10x10
+  http_request_duration_seconds_bucket{app="payments-service", le="0.5"} 0+9x10
+  http_request_duration_seconds_bucket{app="payments-service", le="1"} 0+10x10
+`, 10, preset, plain)
+	defer test.Close()
+
+	test.assertValue(`job:slo_error:ratio5m{name="Preset"}`, minute(10), 0.1)
+	test.assertValue(`job:slo_error:ratio5m{name="Plain"}`, minute(10), 0.1)
+}
+
+func TestLatencySLOValidate(t *testing.T) {
+	parseSLOError(t, "LatencySLO", `
+name: A
+budget: 0.01
+requestClass: "0.5"
+preset: grpc_server
+total: sum(rate(grpc_server_handling_seconds_count[5m]))
+`)
+}
@@ -1,9 +1,24 @@
 package templates
 
 import (
+	"fmt"
+	"strings"
+
 	"github.com/prometheus/prometheus/pkg/rulefmt"
 )
 
+// dependentSLO is implemented by SLOs that are computed from the job:slo_error:ratio<I>
+// series of other SLOs, and must therefore be evaluated after them.
+type dependentSLO interface {
+	Dependencies() []string
+}
+
+// dependencyValidator is implemented by dependent SLOs that can only depend on some SLOs,
+// which they check once their dependencies are known.
+type dependencyValidator interface {
+	validateDependency(SLO) error
+}
+
 // Pipeline can build a RuleGroup that powers the generation of SLO time series. The
 // RuleGroup generated by the Pipeline will include rules installed by templates and the
 // global alerting windows, with each SLOs registered on a Pipeline instance via the
@@ -15,15 +30,41 @@ type Pipeline struct {
 	// SLORules is where each SLO should place the appropriate rules that power the
 	// post-processing and alert trailers.
 	SLORules []rulefmt.Rule
+
+	// DependentRules are produced by SLOs that consume the error ratios of other SLOs.
+	// They're placed after the TemplateRules, in the order they were registered, so each
+	// sees the error ratios of its dependencies from the same evaluation.
+	DependentRules []rulefmt.Rule
+
+	registered map[string]bool
 }
 
 func NewPipeline(name string) *Pipeline {
-	return &Pipeline{name, []rulefmt.Rule{}}
+	return &Pipeline{
+		Name:           name,
+		SLORules:       []rulefmt.Rule{},
+		DependentRules: []rulefmt.Rule{},
+		registered:     map[string]bool{},
+	}
 }
 
+// MustRegister adds the rules for each SLO to the pipeline. SLOs that depend on others
+// must be registered after their dependencies, which SortByDependencies can ensure.
 func (p *Pipeline) MustRegister(slos ...SLO) {
 	for _, slo := range slos {
-		p.SLORules = append(p.SLORules, slo.Rules()...)
+		if dependent, ok := slo.(dependentSLO); ok {
+			for _, dependency := range dependent.Dependencies() {
+				if !p.registered[dependency] {
+					panic(fmt.Sprintf("%s registered before its dependency %s", slo.GetName(), dependency))
+				}
+			}
+
+			p.DependentRules = append(p.DependentRules, slo.Rules()...)
+		} else {
+			p.SLORules = append(p.SLORules, slo.Rules()...)
+		}
+
+		p.registered[slo.GetName()] = true
 	}
 }
 
@@ -35,9 +76,77 @@ func (p *Pipeline) Build() rulefmt.RuleGroups {
 				Rules: flattenRules(
 					p.SLORules,
 					TemplateRules,
+					p.DependentRules,
 					AlertRules,
 				),
 			},
 		},
 	}
 }
+
+// SortByDependencies orders the given SLOs so that every SLO appears after the SLOs it
+// depends on, preserving the original order wherever possible. It fails if names are not
+// unique, an SLO depends on one that doesn't exist or can't depend on, or the dependencies
+// form a cycle.
+func SortByDependencies(slos []SLO) ([]SLO, error) {
+	byName := map[string]SLO{}
+	for _, slo := range slos {
+		if _, ok := byName[slo.GetName()]; ok {
+			return nil, fmt.Errorf("duplicate SLO name: %s", slo.GetName())
+		}
+
+		byName[slo.GetName()] = slo
+	}
+
+	sorted, visited, visiting := []SLO{}, map[string]bool{}, []string{}
+
+	var visit func(slo SLO) error
+	visit = func(slo SLO) error {
+		name := slo.GetName()
+		if visited[name] {
+			return nil
+		}
+
+		for idx, ancestor := range visiting {
+			if ancestor == name {
+				return fmt.Errorf(
+					"dependency cycle between SLOs: %s", strings.Join(append(visiting[idx:], name), " -> "),
+				)
+			}
+		}
+
+		if dependent, ok := slo.(dependentSLO); ok {
+			visiting = append(visiting, name)
+			for _, dependency := range dependent.Dependencies() {
+				target, ok := byName[dependency]
+				if !ok {
+					return fmt.Errorf("%s references unknown SLO: %s", name, dependency)
+				}
+
+				if validator, ok := slo.(dependencyValidator); ok {
+					if err := validator.validateDependency(target); err != nil {
+						return fmt.Errorf("%s: %v", name, err)
+					}
+				}
+
+				if err := visit(target); err != nil {
+					return err
+				}
+			}
+			visiting = visiting[:len(visiting)-1]
+		}
+
+		visited[name] = true
+		sorted = append(sorted, slo)
+
+		return nil
+	}
+
+	for _, slo := range slos {
+		if err := visit(slo); err != nil {
+			return nil, err
+		}
+	}
+
+	return sorted, nil
+}
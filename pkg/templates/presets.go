@@ -0,0 +1,166 @@
+package templates
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/promql"
+)
+
+// Preset describes the metrics produced by a common exporter or instrumentation library,
+// allowing ErrorRateSLO and LatencySLO definitions to reference the preset instead of
+// writing out the PromQL for their request rates.
+//
+// Each field is a metric selector, optionally with label matchers. Definitions that use
+// the preset provide their own label matchers and grouping labels, which are combined
+// with the preset selectors to generate expressions like:
+//
+//	sum by (namespace, release) (rate(http_request_duration_seconds_count{app="payments-service"}[%s]))
+type Preset struct {
+	Total   string // counter of all requests
+	Errors  string // counter of failed requests
+	Buckets string // histogram buckets of request duration, without the le label
+	Count   string // histogram count of request duration
+}
+
+// Presets are available to any SLO definition, and can be extended with LoadPresets
+var Presets = map[string]Preset{
+	// Prometheus client library convention for instrumenting HTTP servers
+	"http_server_histogram": {
+		Total:   `http_request_duration_seconds_count`,
+		Errors:  `http_request_duration_seconds_count{status=~"5.."}`,
+		Buckets: `http_request_duration_seconds_bucket`,
+		Count:   `http_request_duration_seconds_count`,
+	},
+	// go-grpc-prometheus server interceptors, where errors are the codes that indicate a
+	// problem with the server rather than the request
+	"grpc_server": {
+		Total:   `grpc_server_handled_total`,
+		Errors:  `grpc_server_handled_total{grpc_code=~"Unknown|DeadlineExceeded|Unimplemented|Internal|Unavailable|DataLoss"}`,
+		Buckets: `grpc_server_handling_seconds_bucket`,
+		Count:   `grpc_server_handling_seconds_count`,
+	},
+	// OpenTelemetry semantic conventions for HTTP servers, as exported to Prometheus
+	"otel_http_server": {
+		Total:   `http_server_request_duration_seconds_count`,
+		Errors:  `http_server_request_duration_seconds_count{http_response_status_code=~"5.."}`,
+		Buckets: `http_server_request_duration_seconds_bucket`,
+		Count:   `http_server_request_duration_seconds_count`,
+	},
+}
+
+// LoadPresets parses a YAML file of presets and adds them to Presets, replacing any
+// existing presets of the same name:
+//
+//	---
+//	presets:
+//	  nginx_ingress:
+//	    total: nginx_ingress_controller_requests
+//	    errors: nginx_ingress_controller_requests{status=~"5.."}
+//	    buckets: nginx_ingress_controller_request_duration_seconds_bucket
+//	    count: nginx_ingress_controller_request_duration_seconds_count
+//
+// Presets must be loaded before any definitions that reference them are parsed.
+func LoadPresets(payload []byte) error {
+	envelope := struct {
+		Presets map[string]Preset `json:"presets"`
+	}{}
+
+	if err := yaml.Unmarshal(payload, &envelope); err != nil {
+		return err
+	}
+
+	for name, preset := range envelope.Presets {
+		for _, selector := range []string{preset.Total, preset.Errors, preset.Buckets, preset.Count} {
+			if selector == "" {
+				continue
+			}
+
+			if _, err := promql.ParseMetricSelector(selector); err != nil {
+				return fmt.Errorf("invalid preset %s: %v", name, err)
+			}
+		}
+
+		Presets[name] = preset
+	}
+
+	return nil
+}
+
+// presetRates generates the parameterized rates for SLOs that use a preset, from the
+// label matchers and grouping labels of the definition
+type presetRates struct {
+	Preset   string   // name of the preset
+	Selector string   // label matchers applied to each preset selector
+	By       []string // labels to preserve when summing the rates
+}
+
+func (p presetRates) lookup() (Preset, error) {
+	preset, ok := Presets[p.Preset]
+	if !ok {
+		return preset, fmt.Errorf("unknown preset %s", p.Preset)
+	}
+
+	if p.Selector != "" {
+		if _, err := promql.ParseMetricSelector(bracedMatchers(p.Selector)); err != nil {
+			return preset, fmt.Errorf("invalid selector: %v", err)
+		}
+	}
+
+	return preset, nil
+}
+
+// rate sums the rate of the given preset selector, with the definition's matchers and any
+// extra matchers applied. The result is parameterized by the interval as %s, with any
+// other % characters escaped.
+func (p presetRates) rate(selector string, extra ...string) string {
+	matchers, err := promql.ParseMetricSelector(selector)
+	if err != nil {
+		panic(fmt.Sprintf("invalid preset %s: %v", p.Preset, err))
+	}
+
+	if p.Selector != "" {
+		definitionMatchers, err := promql.ParseMetricSelector(bracedMatchers(p.Selector))
+		if err != nil {
+			panic(fmt.Sprintf("invalid selector %s: %v", p.Selector, err))
+		}
+
+		matchers = append(matchers, definitionMatchers...)
+	}
+
+	var metric string
+	rendered := []string{}
+	for _, matcher := range matchers {
+		if matcher.Name == labels.MetricName && matcher.Type == labels.MatchEqual {
+			metric = matcher.Value
+			continue
+		}
+
+		rendered = append(rendered, strings.Replace(matcher.String(), "%", "%%", -1))
+	}
+
+	return fmt.Sprintf(
+		"sum%s (\n  rate(%s{%s}[%%s])\n)",
+		p.grouping(), metric, strings.Join(append(rendered, extra...), ", "),
+	)
+}
+
+func (p presetRates) grouping() string {
+	if len(p.By) == 0 {
+		return ""
+	}
+
+	return fmt.Sprintf(" by (%s)", strings.Join(p.By, ", "))
+}
+
+// bracedMatchers permits label matchers to be given with or without the surrounding braces
+func bracedMatchers(matchers string) string {
+	matchers = strings.TrimSpace(matchers)
+	if !strings.HasPrefix(matchers, "{") {
+		matchers = fmt.Sprintf("{%s}", matchers)
+	}
+
+	return matchers
+}
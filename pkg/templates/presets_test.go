@@ -0,0 +1,41 @@
+package templates
+
+import (
+	"testing"
+)
+
+func TestPresetRates(t *testing.T) {
+	rates := presetRates{Preset: "http_server_histogram", Selector: `app="payments-service"`, By: []string{"namespace"}}
+
+	preset, err := rates.lookup()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "sum by (namespace) (\n  rate(http_request_duration_seconds_count{status=~\"5..\", app=\"payments-service\"}[%s])\n)"
+	if got := rates.rate(preset.Errors); got != expected {
+		t.Errorf("unexpected errors rate\n  got: %s\n  expected: %s", got, expected)
+	}
+}
+
+func TestLoadPresets(t *testing.T) {
+	defer delete(Presets, "nginx_ingress")
+
+	err := LoadPresets([]byte(`
+presets:
+  nginx_ingress:
+    total: nginx_ingress_controller_requests
+    errors: nginx_ingress_controller_requests{status=~"5.."}
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if preset := Presets["nginx_ingress"]; preset.Total != "nginx_ingress_controller_requests" {
+		t.Errorf("expected nginx_ingress preset to be loaded, got %v", preset)
+	}
+
+	if err := LoadPresets([]byte(`{presets: {broken: {total: "requests{"}}}`)); err == nil {
+		t.Errorf("expected invalid selector to be rejected")
+	}
+}
@@ -0,0 +1,125 @@
+package templates
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/prometheus/prometheus/pkg/rulefmt"
+)
+
+var (
+	// QuantileLatencyTemplateRules map from the job:slo_latency_quantile* time series to
+	// the SLO-compliant job:slo_error:ratio<I> series that are used to power alerts.
+	QuantileLatencyTemplateRules = flattenRules(
+		// Each interval is an error if the quantile exceeded the threshold
+		rulefmt.Rule{
+			Record: "job:slo_latency_quantile_error:interval",
+			Expr: unlessExcluded(`
+job:slo_latency_quantile:interval
+  > bool on(name) group_left() job:slo_latency_quantile_threshold:max
+			`),
+		},
+		// Use avg_over_time to map job:slo_latency_quantile_error:interval into error rate
+		// as measured over the common alert window intervals.
+		forIntervals(AlertWindows,
+			rulefmt.Rule{
+				Record: "job:slo_error:ratio%s",
+				Expr:   `avg_over_time(job:slo_latency_quantile_error:interval[%s])`,
+			},
+		),
+	)
+)
+
+func init() {
+	MustRegisterTemplate(QuantileLatencySLO{}, QuantileLatencyTemplateRules...)
+}
+
+// QuantileLatencySLO is used to construct latency SLOs for services that only expose
+// Prometheus summaries, which precompute quantiles in the client rather than providing
+// the histogram buckets required by LatencySLO.
+//
+// To use this template, you provide a parameterized expression for the summary quantile,
+// the quantile you care about and a threshold it should stay below:
+//
+//	max by (namespace, release) (http_request_duration_seconds{app="payments-service", quantile="%s"})
+//
+// If the expression has no placeholder, quantile="<quantile>" is added to every selector.
+//
+// Summary quantiles can't be aggregated into a proportion of requests, so this template
+// uses time-slices instead. Each interval in which the quantile exceeded the threshold is
+// bad, and the error ratio is the proportion of bad intervals. This is an approximation
+// of a request based SLO: an SLO of 99% of intervals having a p99 below 300ms says little
+// about how many requests were slower than 300ms, and this is recorded on the
+// job:slo_definition:none series so it isn't mistaken for one.
+type QuantileLatencySLO struct {
+	baseSLO
+	Quantile    string  // summary quantile to measure, such as 0.99
+	Threshold   float64 // value the quantile must stay below, in the unit of the observation
+	Observation string  // summary quantile, parameterized or without a quantile matcher
+}
+
+func (q QuantileLatencySLO) Validate() error {
+	if quantile, err := strconv.ParseFloat(q.Quantile, 64); err != nil || quantile < 0 || quantile > 1 {
+		return fmt.Errorf("quantile must be a number between 0 and 1, such as 0.99")
+	}
+
+	if q.Threshold <= 0 {
+		return fmt.Errorf("threshold must be positive")
+	}
+
+	if q.Observation == "" {
+		return fmt.Errorf("observation must be provided")
+	}
+
+	observation, err := q.observation()
+	if err != nil {
+		return fmt.Errorf("invalid observation %s: %v", q.Observation, err)
+	}
+
+	if err := q.validateExprs(observation); err != nil {
+		return err
+	}
+
+	return q.validateDimensions("max", observation)
+}
+
+func (q QuantileLatencySLO) Rules() []rulefmt.Rule {
+	threshold := strconv.FormatFloat(q.Threshold, 'f', -1, 64)
+	observation, _ := q.observation()
+
+	return flattenRules(
+		q.baseSLO.Rules(
+			map[string]string{
+				"template":    "QuantileLatencySLO",
+				"quantile":    q.Quantile,
+				"threshold":   threshold,
+				"observation": q.Observation,
+				"approximation": fmt.Sprintf(
+					"time-slice: proportion of intervals where the %s quantile exceeded %s, not the proportion of requests",
+					q.Quantile, threshold,
+				),
+			},
+		),
+		rulefmt.Rule{
+			Record: "job:slo_latency_quantile_threshold:max",
+			Labels: q.joinLabels(),
+			Expr:   threshold,
+		},
+		q.dimensionRules("max", q.mustRender(observation)),
+		rulefmt.Rule{
+			Record: "job:slo_latency_quantile:interval",
+			Labels: q.joinLabels(),
+			Expr:   q.mustAggregate("max", q.mustRender(observation)),
+		},
+	)
+}
+
+// observation selects the summary quantile, either by formatting it into the parameterized
+// observation or by adding a quantile matcher to every selector
+func (q QuantileLatencySLO) observation() (string, error) {
+	if isParameterized(q.Observation) {
+		return fmt.Sprintf(q.Observation, q.Quantile), parseExpr(q.Observation, q.Quantile)
+	}
+
+	return withMatchers(q.Observation, equalMatcher("quantile", q.Quantile))
+}
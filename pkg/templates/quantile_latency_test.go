@@ -0,0 +1,57 @@
+package templates
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestQuantileLatencySLO(t *testing.T) {
+	slo := mustParseSLO(t, "QuantileLatencySLO", `
+name: Gateway
+budget: 0.01
+quantile: "0.99"
+threshold: 0.5
+observation: max(gateway_request_duration_seconds)
+`)
+
+	test := evalSLOs(t, `
+load 1m
+  gateway_request_duration_seconds{quantile="0.5"} 0.1 0.1 0.1 0.1 0.1
+  gateway_request_duration_seconds{quantile="0.99"} 0.2 0.6 0.4 0.7 0.3
+`, 4, slo)
+	defer test.Close()
+
+	for idx, expected := range []float64{0, 1, 0, 1, 0} {
+		test.assertValue(`job:slo_latency_quantile_error:interval{name="Gateway"}`, minute(idx), expected)
+	}
+
+	test.assertValue(`job:slo_error:ratio5m{name="Gateway"}`, minute(4), 0.4)
+
+	// The quantile is part of the definition, not a label of the error ratio
+	test.assertValue(`job:slo_error:ratio5m{name="Gateway", quantile=""}`, minute(4), 0.4)
+	test.assertAbsent(`job:slo_latency_quantile:interval{quantile!=""}`, minute(4))
+}
+
+func TestQuantileLatencySLOValidate(t *testing.T) {
+	for _, threshold := range []string{"", "threshold: 0", "threshold: -0.5"} {
+		parseSLOError(t, "QuantileLatencySLO", `
+name: Gateway
+budget: 0.01
+quantile: "0.99"
+observation: max(gateway_request_duration_seconds)
+`+threshold)
+	}
+
+	for _, quantile := range []string{`""`, `"p99"`, `"-0.1"`, `"1.5"`, `"99"`} {
+		err := parseSLOError(t, "QuantileLatencySLO", `
+name: Gateway
+budget: 0.01
+quantile: `+quantile+`
+threshold: 0.5
+observation: max(gateway_request_duration_seconds)
+`)
+		if !strings.Contains(err.Error(), "quantile must be a number between 0 and 1") {
+			t.Errorf("expected quantile %s to be rejected, got %v", quantile, err)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package templates
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/pkg/rulefmt"
+)
+
+var (
+	// QueueLatencyTemplateRules map from the job:slo_queue_* time series to the
+	// SLO-compliant job:slo_error:ratio<I> series that are used to power alerts.
+	QueueLatencyTemplateRules = flattenRules(
+		// Estimate how long it would take to work through the messages currently waiting,
+		// which is how long a message joining the queue now can expect to wait. An empty
+		// queue has nothing to drain, even if nothing is being processed, while messages
+		// that aren't being processed at all will wait forever.
+		rulefmt.Rule{
+			Record: "job:slo_queue_drain_time:seconds",
+			Expr: `
+(job:slo_queue_backlog:count > 0)
+  / (job:slo_queue_drain:rate or 0 * job:slo_queue_backlog:count)
+or
+job:slo_queue_backlog:count == 0
+			`,
+		},
+		// Each interval is an error if the oldest message has waited longer than the
+		// maximum wait, or if we can't drain the backlog within the maximum wait.
+		rulefmt.Rule{
+			Record: "job:slo_queue_error:interval",
+			Expr: unlessExcluded(`
+clamp_max(
+  (job:slo_queue_age:seconds > bool on(name) group_left() job:slo_queue_max_wait:seconds)
+  + (
+    (job:slo_queue_drain_time:seconds > bool on(name) group_left() job:slo_queue_max_wait:seconds)
+    or 0 * job:slo_queue_age:seconds
+  ),
+  1.0
+)
+			`),
+		},
+		// Use avg_over_time to map job:slo_queue_error:interval into error rate as measured
+		// over the common alert window intervals.
+		forIntervals(AlertWindows,
+			rulefmt.Rule{
+				Record: "job:slo_error:ratio%s",
+				Expr:   `avg_over_time(job:slo_queue_error:interval[%s])`,
+			},
+		),
+	)
+)
+
+func init() {
+	MustRegisterTemplate(QueueLatencySLO{}, QueueLatencyTemplateRules...)
+}
+
+// QueueLatencySLO is used to construct SLOs for asynchronous workers, where the objective
+// is on how long a message waits in a queue before being processed.
+//
+// To use this template, you provide a measure of the age of the oldest message in the
+// queue, in seconds, along with the maximum time a message should wait. Each interval in
+// which the oldest message has waited longer than this is counted as an error.
+//
+// Optionally, you can also provide the number of messages waiting along with the rate at
+// which they are processed. The time it would take to drain the backlog at that rate is
+// what a newly queued message can expect to wait, so intervals where this exceeds the
+// maximum wait are also counted as errors. This catches a queue that is falling behind
+// before its oldest message has breached the objective.
+type QueueLatencySLO struct {
+	baseSLO
+	MaxWait   serializeableDuration // longest a message should wait before being processed
+	Age       string                // age in seconds of the oldest message in the queue
+	Backlog   string                // number of messages waiting, optional
+	DrainRate string                // messages processed per second, required with Backlog
+}
+
+func (q QueueLatencySLO) Validate() error {
+	if q.Age == "" {
+		return fmt.Errorf("age must be provided")
+	}
+
+	if q.MaxWait <= 0 {
+		return fmt.Errorf("maxWait must be a positive duration")
+	}
+
+	if (q.Backlog == "") != (q.DrainRate == "") {
+		return fmt.Errorf("backlog and drainRate must be provided together")
+	}
+
+	if err := q.validateExprs(q.Age, q.Backlog, q.DrainRate); err != nil {
+		return err
+	}
+
+	if err := q.validateDimensions("max", q.Age); err != nil {
+		return err
+	}
+
+	return q.validateDimensions("sum", q.Backlog, q.DrainRate)
+}
+
+func (q QueueLatencySLO) Rules() []rulefmt.Rule {
+	definition := map[string]string{
+		"template": "QueueLatencySLO",
+		"max_wait": model.Duration(q.MaxWait).String(),
+		"age":      q.Age,
+	}
+
+	if q.Backlog != "" {
+		definition["backlog"] = q.Backlog
+		definition["drain_rate"] = q.DrainRate
+	}
+
+	rules := flattenRules(
+		q.baseSLO.Rules(definition),
+		q.dimensionRules("max", q.mustRender(q.Age)),
+		rulefmt.Rule{
+			Record: "job:slo_queue_max_wait:seconds",
+			Labels: q.joinLabels(),
+			Expr:   fmt.Sprintf("%d", time.Duration(q.MaxWait)/time.Second),
+		},
+		rulefmt.Rule{
+			Record: "job:slo_queue_age:seconds",
+			Labels: q.joinLabels(),
+			Expr:   q.mustAggregate("max", q.mustRender(q.Age)),
+		},
+	)
+
+	if q.Backlog != "" {
+		rules = append(
+			rules,
+			rulefmt.Rule{
+				Record: "job:slo_queue_backlog:count",
+				Labels: q.joinLabels(),
+				Expr:   q.mustAggregate("sum", q.mustRender(q.Backlog)),
+			},
+			rulefmt.Rule{
+				Record: "job:slo_queue_drain:rate",
+				Labels: q.joinLabels(),
+				Expr:   q.mustAggregate("sum", q.mustRender(q.DrainRate)),
+			},
+		)
+	}
+
+	return rules
+}
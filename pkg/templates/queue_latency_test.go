@@ -0,0 +1,51 @@
+package templates
+
+import (
+	"fmt"
+	"math"
+	"testing"
+)
+
+func TestQueueLatencySLODrainTime(t *testing.T) {
+	slos := []SLO{}
+	for _, queue := range []string{"empty", "draining", "stalled", "stuck"} {
+		slos = append(slos, mustParseSLO(t, "QueueLatencySLO", fmt.Sprintf(`
+name: %[1]s
+budget: 0.01
+maxWait: 5m
+age: max(queue_oldest_age_seconds{queue="%[1]s"})
+backlog: sum(queue_size{queue="%[1]s"})
+drainRate: sum(rate(queue_processed_total{queue="%[1]s"}[5m]))
+`, queue)))
+	}
+
+	// Nothing processes the stuck queue at all, so it has no drain rate
+	test := evalSLOs(t, `
+load 1m
+  queue_oldest_age_seconds{queue="empty"} 0+0x10
+  queue_oldest_age_seconds{queue="draining"} 10+0x10
+  queue_oldest_age_seconds{queue="stalled"} 10+0x10
+  queue_oldest_age_seconds{queue="stuck"} 10+0x10
+  queue_size{queue="empty"} 0+0x10
+  queue_size{queue="draining"} 60+0x10
+  queue_size{queue="stalled"} 60+0x10
+  queue_size{queue="stuck"} 60+0x10
+  queue_processed_total{queue="draining"} 0+60x10
+  queue_processed_total{queue="stalled"} 0+0x10
+`, 10, slos...)
+	defer test.Close()
+
+	for _, tc := range []struct {
+		queue     string
+		drainTime float64
+		errors    float64
+	}{
+		{"empty", 0, 0},
+		{"draining", 60, 0},
+		{"stalled", math.Inf(1), 1},
+		{"stuck", math.Inf(1), 1},
+	} {
+		test.assertValue(fmt.Sprintf(`job:slo_queue_drain_time:seconds{name="%s"}`, tc.queue), minute(10), tc.drainTime)
+		test.assertValue(fmt.Sprintf(`job:slo_queue_error:interval{name="%s"}`, tc.queue), minute(10), tc.errors)
+	}
+}
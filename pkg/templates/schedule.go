@@ -0,0 +1,134 @@
+package templates
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/prometheus/prometheus/pkg/rulefmt"
+)
+
+// Some systems only matter during business hours, such as back-office tools that are used
+// by staff in the UK. Definitions of most templates can declare a schedule, outside of
+// which the SLO is excluded:
+//
+//	schedule:
+//	  timezone: Europe/London
+//	  weekdays: [mon, tue, wed, thu, fri]
+//	  start: "09:00"
+//	  end: "17:30"
+//	  holidays: [2026-12-25, 2026-12-28]
+//
+// The schedule is evaluated in local time, accounting for daylight saving, and produces:
+//
+// - job:slo_schedule_local_time:timestamp{name}, the local time as if it were UTC
+// - job:slo_schedule_open:bool{name}, which is 1 within the schedule and 0 outside it
+//
+// Time outside the schedule is then excluded exactly as described in exclusions.go, so
+// doesn't count towards the error ratio, and the burn alerts don't fire.
+//
+// Templates that don't support exclusions don't support schedules either. Those measured
+// per run, BatchCompletionSLO and ScheduledJobSLO, have no excluded time to drop, as each
+// run either succeeded or didn't, however much of it fell outside the schedule. Schedule
+// the job itself to run within business hours instead. CompositeSLO combines the error
+// ratios of its components, which already exclude any time outside their own schedules.
+
+type schedule struct {
+	Timezone serializeableLocation  `json:"timezone"` // timezone of the schedule, such as Europe/London
+	Weekdays []serializeableWeekday `json:"weekdays"` // days of the schedule, defaulting to Monday to Friday
+	Start    serializeableTimeOfDay `json:"start"`    // local time of day the schedule opens
+	End      serializeableTimeOfDay `json:"end"`      // local time of day the schedule closes, or midnight if not given
+	Holidays []serializeableDate    `json:"holidays"` // local dates on which the schedule is closed
+}
+
+// defined decides whether the SLO has a schedule
+func (s schedule) defined() bool {
+	return s.Timezone.Location != nil || len(s.Weekdays) > 0 || s.Start != 0 || s.End != 0 || len(s.Holidays) > 0
+}
+
+func (s schedule) validate() error {
+	if s.End != 0 && s.End <= s.Start {
+		return fmt.Errorf("schedule must end after it starts, as schedules can't span midnight")
+	}
+
+	return nil
+}
+
+func (s schedule) weekdays() []serializeableWeekday {
+	if len(s.Weekdays) == 0 {
+		return businessDays
+	}
+
+	return s.Weekdays
+}
+
+// definition records the schedule in the labels of job:slo_definition:none
+func (s schedule) definition() map[string]string {
+	if !s.defined() {
+		return map[string]string{}
+	}
+
+	hours := s.Start.String() + "-"
+	if s.End != 0 {
+		hours += s.End.String()
+	}
+
+	definition := map[string]string{
+		"schedule_timezone": s.Timezone.location().String(),
+		"schedule_weekdays": weekdayNames(s.weekdays()),
+		"schedule_hours":    hours,
+	}
+
+	if len(s.Holidays) > 0 {
+		holidays := []string{}
+		for _, holiday := range s.Holidays {
+			holidays = append(holidays, holiday.String())
+		}
+
+		definition["schedule_holidays"] = strings.Join(holidays, ",")
+	}
+
+	return definition
+}
+
+// scheduleRules generates the local time and job:slo_schedule_open:bool for SLOs that
+// have a schedule
+func (b baseSLO) scheduleRules() []rulefmt.Rule {
+	if !b.Schedule.defined() {
+		return []rulefmt.Rule{}
+	}
+
+	local := fmt.Sprintf(`job:slo_schedule_local_time:timestamp{name="%s"}`, b.Name)
+	secondsOfDay := fmt.Sprintf("(3600 * hour(%[1]s) + 60 * minute(%[1]s))", local)
+
+	open := fmt.Sprintf("(0 * %s + 1)\nand (%s)", local, onWeekdays(local, b.Schedule.weekdays()))
+	if b.Schedule.Start != 0 {
+		open += fmt.Sprintf("\nand (%s >= %d)", secondsOfDay, time.Duration(b.Schedule.Start)/time.Second)
+	}
+
+	if b.Schedule.End != 0 {
+		open += fmt.Sprintf("\nand (%s < %d)", secondsOfDay, time.Duration(b.Schedule.End)/time.Second)
+	}
+
+	if len(b.Schedule.Holidays) > 0 {
+		holidays := []string{}
+		for _, holiday := range b.Schedule.Holidays {
+			holidays = append(holidays, fmt.Sprintf("floor(%s / 86400) == %d", local, holiday.epochDay()))
+		}
+
+		open += fmt.Sprintf("\nunless (%s)", strings.Join(holidays, " or "))
+	}
+
+	return []rulefmt.Rule{
+		rulefmt.Rule{
+			Record: "job:slo_schedule_local_time:timestamp",
+			Labels: b.joinLabels(),
+			Expr:   localTime(b.Schedule.Timezone.location(), time.Duration(b.Delay)),
+		},
+		rulefmt.Rule{
+			Record: "job:slo_schedule_open:bool",
+			Labels: b.joinLabels(),
+			Expr:   fmt.Sprintf("(\n  %s\n)\nor\n0 * %s", strings.Replace(open, "\n", "\n  ", -1), local),
+		},
+	}
+}
@@ -0,0 +1,79 @@
+package templates
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSchedule(t *testing.T) {
+	defer withTimezoneTransitions(
+		time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC),
+		time.Date(2021, time.January, 1, 0, 0, 0, 0, time.UTC),
+	)()
+
+	slo := mustParseSLO(t, "ErrorRateSLO", `
+name: Backoffice
+budget: 0.01
+errors: sum(rate(http_requests_total{status="500"}[5m]))
+total: sum(rate(http_requests_total[5m]))
+schedule:
+  timezone: Europe/London
+  start: "09:00"
+  end: "17:30"
+  holidays: [2020-10-27]
+`)
+
+	for _, tc := range []struct {
+		name     string
+		ts       time.Time
+		expected float64
+	}{
+		// London moves from GMT to BST at 01:00 UTC on Sunday 29 March 2020
+		{"before opening in GMT", time.Date(2020, time.March, 27, 8, 59, 0, 0, time.UTC), 0},
+		{"opening in GMT", time.Date(2020, time.March, 27, 9, 0, 0, 0, time.UTC), 1},
+		{"weekend of march transition", time.Date(2020, time.March, 29, 12, 0, 0, 0, time.UTC), 0},
+		{"before opening in BST", time.Date(2020, time.March, 30, 7, 59, 0, 0, time.UTC), 0},
+		{"opening in BST", time.Date(2020, time.March, 30, 8, 0, 0, 0, time.UTC), 1},
+		{"before closing in BST", time.Date(2020, time.March, 30, 16, 29, 0, 0, time.UTC), 1},
+		{"closing in BST", time.Date(2020, time.March, 30, 16, 30, 0, 0, time.UTC), 0},
+
+		// London moves from BST to GMT at 01:00 UTC on Sunday 25 October 2020
+		{"before closing before october transition", time.Date(2020, time.October, 23, 16, 29, 0, 0, time.UTC), 1},
+		{"closing before october transition", time.Date(2020, time.October, 23, 16, 30, 0, 0, time.UTC), 0},
+		{"weekend of october transition", time.Date(2020, time.October, 25, 12, 0, 0, 0, time.UTC), 0},
+		{"before opening after october transition", time.Date(2020, time.October, 26, 8, 0, 0, 0, time.UTC), 0},
+		{"opening after october transition", time.Date(2020, time.October, 26, 9, 0, 0, 0, time.UTC), 1},
+		{"closing after october transition", time.Date(2020, time.October, 26, 17, 30, 0, 0, time.UTC), 0},
+		{"holiday", time.Date(2020, time.October, 27, 12, 0, 0, 0, time.UTC), 0},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			test := evalAt(t, slo.Rules(), tc.ts)
+			defer test.Close()
+
+			test.assertValue(`job:slo_schedule_open:bool{name="Backoffice"}`, tc.ts, tc.expected)
+			test.assertValue(`job:slo_exclusion:active{name="Backoffice"}`, tc.ts, 1-tc.expected)
+		})
+	}
+}
+
+func TestScheduleUnsupported(t *testing.T) {
+	schedule := `
+schedule:
+  start: "09:00"
+  end: "17:30"
+`
+
+	parseSLOError(t, "BatchCompletionSLO", `
+name: Submission
+budget: 0.05
+deadline: 30m
+started: max(submission_last_started_timestamp_seconds)
+completed: max(submission_last_completed_timestamp_seconds)
+`+schedule)
+
+	parseSLOError(t, "CompositeSLO", `
+name: Journey
+budget: 0.01
+components: [{name: API}]
+`+schedule)
+}
@@ -0,0 +1,206 @@
+package templates
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/pkg/rulefmt"
+)
+
+func init() {
+	MustRegisterTemplate(ScheduledJobSLO{})
+}
+
+// ScheduledJobSLO is used to construct SLOs for jobs that run on a schedule, such as
+// Kubernetes CronJobs, where the objective is that some proportion of scheduled runs
+// succeed and that no runs are skipped.
+//
+// To use this template, you provide the timestamp at which the job was last scheduled,
+// and the timestamp at which it last completed successfully, along with how often the
+// job is expected to run. For CronJobs, kube-state-metrics provides these as:
+//
+//	kube_cronjob_status_last_schedule_time{namespace="payments", cronjob="expire-mandates"}
+//	kube_cronjob_status_last_successful_time{namespace="payments", cronjob="expire-mandates"}
+//
+// Each time one of these timestamps changes counts as one scheduled or successful run.
+// Over each alert window, we expect at least one run per cadence, and the error ratio is
+// the proportion of those runs that didn't succeed. Runs that fail and runs that are
+// never scheduled both consume error budget, while a failed job that eventually succeeds
+// on retry is only a single successful run.
+//
+// Optionally, you can also provide one series for each run that has failed, and one for
+// each run that has finished, whether it succeeded or failed. With kube-state-metrics,
+// these are the Jobs owned by the CronJob whose failed or complete conditions are true:
+//
+//	kube_job_failed{condition="true", namespace="payments", job_name=~"expire-mandates-.*"}
+//	kube_job_complete{condition="true", namespace="payments", job_name=~"expire-mandates-.*"}
+//	  or kube_job_failed{condition="true", namespace="payments", job_name=~"expire-mandates-.*"}
+//
+// Runs that first appear within a window count as having finished in it, and the error
+// ratio becomes the worse of the proportion of scheduled runs that didn't succeed and the
+// proportion of finished runs that failed. This catches runs that fail even though the
+// job has been rescheduled and succeeded since.
+//
+// Windows that are shorter than the cadence can't contain a complete run, so they are
+// measured over the cadence instead. A job that runs hourly will have identical 1m, 5m,
+// 30m and 1h error ratios, each of which reflects whether the last hour's run succeeded.
+//
+// Exclusions and schedules aren't supported, as each run is counted when it happens
+// rather than over the time it spans. Jobs that should only run at certain times should
+// be scheduled to do so.
+type ScheduledJobSLO struct {
+	baseSLO
+	Cadence      serializeableDuration // expected time between scheduled runs
+	LastSchedule string                // unix timestamp the job was last scheduled
+	LastSuccess  string                // unix timestamp the job last completed successfully
+	Failed       string                // one series for each run that failed, optional
+	Total        string                // one series for each run that finished, required with Failed
+}
+
+func (s ScheduledJobSLO) Validate() error {
+	if s.Cadence <= 0 {
+		return fmt.Errorf("cadence must be a positive duration")
+	}
+
+	if s.LastSchedule == "" || s.LastSuccess == "" {
+		return fmt.Errorf("lastSchedule and lastSuccess must be provided")
+	}
+
+	if (s.Failed == "") != (s.Total == "") {
+		return fmt.Errorf("failed and total must be provided together")
+	}
+
+	if s.excluded() {
+		return fmt.Errorf("exclusions and schedules aren't supported, as budget is consumed per run rather than over time")
+	}
+
+	if err := s.validateExprs(s.LastSchedule, s.LastSuccess, s.Failed, s.Total); err != nil {
+		return err
+	}
+
+	return s.validateDimensions("max", s.LastSchedule, s.LastSuccess)
+}
+
+func (s ScheduledJobSLO) Rules() []rulefmt.Rule {
+	definition := map[string]string{
+		"template":      "ScheduledJobSLO",
+		"cadence":       model.Duration(s.Cadence).String(),
+		"last_schedule": s.LastSchedule,
+		"last_success":  s.LastSuccess,
+	}
+
+	if s.Failed != "" {
+		definition["failed"] = s.Failed
+		definition["total"] = s.Total
+	}
+
+	rules := flattenRules(
+		s.baseSLO.Rules(definition),
+		s.dimensionRules("max", s.mustRender(s.LastSchedule)),
+		rulefmt.Rule{
+			Record: "job:slo_scheduled_job_last_schedule:timestamp",
+			Labels: s.joinLabels(),
+			Expr:   s.mustAggregate("max", s.mustRender(s.LastSchedule)),
+		},
+		rulefmt.Rule{
+			Record: "job:slo_scheduled_job_last_success:timestamp",
+			Labels: s.joinLabels(),
+			Expr:   s.mustAggregate("max", s.mustRender(s.LastSuccess)),
+		},
+	)
+
+	if s.Failed != "" {
+		rules = append(
+			rules,
+			rulefmt.Rule{
+				Record: "job:slo_scheduled_job_failed:run",
+				Labels: s.joinLabels(),
+				Expr:   s.mustRender(s.Failed),
+			},
+			rulefmt.Rule{
+				Record: "job:slo_scheduled_job_finished:run",
+				Labels: s.joinLabels(),
+				Expr:   s.mustRender(s.Total),
+			},
+		)
+	}
+
+	for _, interval := range AlertWindows {
+		window, err := model.ParseDuration(interval)
+		if err != nil {
+			panic(fmt.Sprintf("invalid alert window %s: %v", interval, err))
+		}
+
+		if window < model.Duration(s.Cadence) {
+			window = model.Duration(s.Cadence)
+		}
+
+		// A job that has never succeeded may not have a last success at all, in which case
+		// none of its scheduled runs succeeded
+		ratio := fmt.Sprintf(
+			`clamp_min(
+  1 - (
+    changes(job:slo_scheduled_job_last_success:timestamp{name="%[1]s"}[%[2]s])
+    or 0 * job:slo_scheduled_job_last_schedule:timestamp{name="%[1]s"}
+  )
+    / clamp_min(changes(job:slo_scheduled_job_last_schedule:timestamp{name="%[1]s"}[%[2]s]), %[3]d),
+  0
+)`,
+			s.Name, window, time.Duration(window)/time.Duration(s.Cadence),
+		)
+
+		if s.Failed != "" {
+			rules = append(rules, s.runRules(interval, window)...)
+			ratio = fmt.Sprintf(
+				`max by (%[1]s) (
+  label_replace(
+    %[2]s,
+    "measure", "schedule", "", ""
+  )
+  or
+  job:slo_scheduled_job_failed:count%[3]s{name="%[4]s"}
+    / job:slo_scheduled_job_finished:count%[3]s{name="%[4]s"}
+)`,
+				strings.Join(s.runGrouping(), ", "), strings.Replace(ratio, "\n", "\n    ", -1), interval, s.Name,
+			)
+		}
+
+		rules = append(rules, rulefmt.Rule{
+			Record: fmt.Sprintf("job:slo_error:ratio%s", interval),
+			Labels: s.joinLabels(),
+			Expr:   ratio,
+		})
+	}
+
+	return rules
+}
+
+// runRules count the runs that first appeared within the window, from the series for each
+// failed and finished run
+func (s ScheduledJobSLO) runRules(interval string, window model.Duration) []rulefmt.Rule {
+	appeared := func(record string) string {
+		selector := fmt.Sprintf(`%s{name="%s"}`, record, s.Name)
+		return aggregateBy("count", s.runGrouping(), fmt.Sprintf("%s unless %s offset %s", selector, selector, window))
+	}
+
+	return []rulefmt.Rule{
+		rulefmt.Rule{
+			Record: fmt.Sprintf("job:slo_scheduled_job_finished:count%s", interval),
+			Expr:   appeared("job:slo_scheduled_job_finished:run"),
+		},
+		rulefmt.Rule{
+			Record: fmt.Sprintf("job:slo_scheduled_job_failed:count%s", interval),
+			Expr: fmt.Sprintf(
+				"%s\nor\n0 * job:slo_scheduled_job_finished:count%s{name=\"%s\"}",
+				appeared("job:slo_scheduled_job_failed:run"), interval, s.Name,
+			),
+		},
+	}
+}
+
+// runGrouping is how runs are counted, as every other label of a run identifies it
+func (s ScheduledJobSLO) runGrouping() []string {
+	return append([]string{"name"}, s.Dimensions...)
+}
@@ -0,0 +1,91 @@
+package templates
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestScheduledJobSLO(t *testing.T) {
+	definition := `
+name: %s
+budget: 0.05
+cadence: 1m
+lastSchedule: max(cronjob_last_schedule_time)
+lastSuccess: max(cronjob_last_successful_time)
+`
+
+	plain := mustParseSLO(t, "ScheduledJobSLO", fmt.Sprintf(definition, "Plain"))
+	runs := mustParseSLO(t, "ScheduledJobSLO", fmt.Sprintf(definition, "Runs")+`
+failed: job_failed{condition="true"}
+total: job_complete{condition="true"} or job_failed{condition="true"}
+`)
+
+	// The job runs every minute, and while the last success keeps up with the schedule,
+	// the fifth run failed before a retry succeeded
+	load := []string{
+		"load 1m",
+		"  cronjob_last_schedule_time 0+60x20",
+		"  cronjob_last_successful_time 0+60x20",
+		`  job_failed{condition="true", job_name="run-5"} _x5 1+0x14`,
+	}
+
+	for run := 1; run <= 10; run++ {
+		if run != 5 {
+			load = append(load, fmt.Sprintf(`  job_complete{condition="true", job_name="run-%d"} _x%d 1+0x%d`, run, run, 19-run))
+		}
+	}
+
+	test := evalSLOs(t, strings.Join(load, "\n"), 10, plain, runs)
+	defer test.Close()
+
+	test.assertValue(`job:slo_error:ratio5m{name="Plain"}`, minute(9), 0)
+	test.assertValue(`job:slo_scheduled_job_finished:count5m{name="Runs"}`, minute(9), 5)
+	test.assertValue(`job:slo_scheduled_job_failed:count5m{name="Runs"}`, minute(9), 1)
+	test.assertValue(`job:slo_error:ratio5m{name="Runs"}`, minute(9), 0.2)
+
+	// Once the failed run is older than the window, only the schedule counts
+	test.assertValue(`job:slo_scheduled_job_failed:count5m{name="Runs"}`, minute(10), 0)
+	test.assertValue(`job:slo_error:ratio5m{name="Runs"}`, minute(10), 0)
+}
+
+func TestScheduledJobSLOMissedRuns(t *testing.T) {
+	definition := `
+name: %s
+budget: 0.05
+cadence: 1m
+lastSchedule: max(cronjob_last_schedule_time{cronjob="%[2]s"})
+lastSuccess: max(cronjob_last_successful_time{cronjob="%[2]s"})
+`
+
+	skipped := mustParseSLO(t, "ScheduledJobSLO", fmt.Sprintf(definition, "Skipped", "skipped"))
+	never := mustParseSLO(t, "ScheduledJobSLO", fmt.Sprintf(definition, "Never", "never"))
+
+	// The skipped job stops being scheduled after its fifth run, while the other job has
+	// never succeeded, so has no last success at all
+	test := evalSLOs(t, `
+load 1m
+  cronjob_last_schedule_time{cronjob="skipped"} 0+60x5 300+0x5
+  cronjob_last_successful_time{cronjob="skipped"} 0+60x5 300+0x5
+  cronjob_last_schedule_time{cronjob="never"} 0+60x10
+`, 10, skipped, never)
+	defer test.Close()
+
+	test.assertValue(`job:slo_error:ratio5m{name="Skipped"}`, minute(5), 0)
+	test.assertValue(`job:slo_error:ratio5m{name="Skipped"}`, minute(7), 0.4)
+	test.assertValue(`job:slo_error:ratio5m{name="Skipped"}`, minute(10), 1)
+
+	test.assertValue(`job:slo_error:ratio5m{name="Never"}`, minute(9), 1)
+	test.assertValue(`job:slo_error:ratio1h{name="Never"}`, minute(9), 1)
+}
+
+func TestScheduledJobSLOValidate(t *testing.T) {
+	parseSLOError(t, "ScheduledJobSLO", `
+name: Job
+budget: 0.05
+cadence: 1h
+lastSchedule: max(cronjob_last_schedule_time)
+lastSuccess: max(cronjob_last_successful_time)
+failed: job_failed{condition="true"}
+`)
+}
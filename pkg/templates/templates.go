@@ -17,6 +17,7 @@
 package templates
 
 import (
+	"fmt"
 	"reflect"
 	"time"
 
@@ -48,13 +49,17 @@ var (
 	// AlertRules every SLO type produces rules that terminate in job:slo_error:ratio<I> and
 	// job:slo_error_budget's. Together, we can use these rules to power generic
 	// multi-window SLO error budget burn alerts, and these alert rules are run as the final
-	// part of the Pipeline generated RuleGroup.
+	// part of the Pipeline generated RuleGroup. SLOs with dimensions have an error ratio
+	// for each combination of dimension labels, and the burn alerts fire for each. SLOs
+	// that attribute their errors list the top contributors in the alert annotations, and
+	// the burn alerts never fire while an SLO is excluded. Every alert takes its channel
+	// and severity from the labels of the SLO, by joining job:slo_labels_info.
 	AlertRules = []rulefmt.Rule{
 		rulefmt.Rule{
 			Alert: "SLOErrorBudgetFastBurn",
 			For:   model.Duration(time.Minute),
-			Labels: map[string]string{
-				"severity": "ticket", // TODO: "page",
+			Annotations: map[string]string{
+				"top_contributors": topContributors("1h"),
 			},
 			Expr: `
 ((
@@ -67,14 +72,15 @@ or
   job:slo_error:ratio6h > on(name) group_left() (6.0 * job:slo_error_budget:ratio)
 and
   job:slo_error:ratio30m > on(name) group_left() (6.0 * job:slo_error_budget:ratio)
-)) * on(name) group_left(channel) job:slo_labels_info
+)) * on(name) group_left(channel, severity) job:slo_labels_info
+unless on(name) (job:slo_exclusion:active > 0)
 			`,
 		},
 		rulefmt.Rule{
 			Alert: "SLOErrorBudgetSlowBurn",
 			For:   model.Duration(time.Hour),
-			Labels: map[string]string{
-				"severity": "ticket",
+			Annotations: map[string]string{
+				"top_contributors": topContributors("1d"),
 			},
 			Expr: `
 ((
@@ -87,8 +93,36 @@ or
   job:slo_error:ratio3d > on(name) group_left() (1.0 * job:slo_error_budget:ratio)
 and
   job:slo_error:ratio6h > on(name) group_left() (1.0 * job:slo_error_budget:ratio)
-)) * on(name) group_left(channel) jobs:slo_labels_info
+)) * on(name) group_left(channel, severity) job:slo_labels_info
+unless on(name) (job:slo_exclusion:active > 0)
+			`,
+		},
+		rulefmt.Rule{
+			Alert: "SLODimensionsOverLimit",
+			For:   model.Duration(10 * time.Minute),
+			Expr: `
+(
+  job:slo_dimensions:count > on(name) job:slo_dimensions:max
+) * on(name) group_left(channel, severity) job:slo_labels_info
 			`,
 		},
 	}
 )
+
+// topContributors renders an alert annotation that lists the top contributors to the
+// errors of the SLO over the given window, for SLOs that attribute their errors. The
+// contributors are selected by every label of the alert other than those joined from
+// job:slo_labels_info, so an alert for one combination of dimensions only lists the
+// contributors to that combination.
+func topContributors(window string) string {
+	return fmt.Sprintf(
+		`{{ $selector := printf "name=%%q" $labels.name }}`+
+			`{{ range $label, $value := $labels }}{{ if not (eq $label "name" "channel" "severity") }}`+
+			`{{ $selector = printf "%%s, %%s=%%q" $selector $label $value }}`+
+			`{{ end }}{{ end }}`+
+			`{{ range query (printf "sort_desc(job:slo_error_attribution_top:ratio%s{%%s})" $selector) }}`+
+			`{{ .Labels.contributor }}: {{ .Value | humanizePercentage }}
+{{ end }}`,
+		window,
+	)
+}
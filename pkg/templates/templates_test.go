@@ -0,0 +1,305 @@
+package templates
+
+import (
+	"fmt"
+	"io/ioutil"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	yaml "gopkg.in/yaml.v2"
+
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/pkg/rulefmt"
+	"github.com/prometheus/prometheus/pkg/timestamp"
+	"github.com/prometheus/prometheus/pkg/value"
+	"github.com/prometheus/prometheus/promql"
+)
+
+// ruleTest evaluates generated rules against series loaded in the format of the promql
+// tests, such as:
+//
+//	load 1m
+//	  http_requests_total{status="500"} 0+1x60
+//
+// Recording rules are evaluated in order at each step, with their results appended to
+// the storage exactly as Prometheus would, so rules can depend on those before them.
+type ruleTest struct {
+	*promql.Test
+	t *testing.T
+}
+
+func newRuleTest(t *testing.T, load string) *ruleTest {
+	test, err := promql.NewTest(t, load)
+	if err != nil {
+		t.Fatalf("invalid series: %v", err)
+	}
+
+	if err := test.Run(); err != nil {
+		t.Fatalf("failed to load series: %v", err)
+	}
+
+	return &ruleTest{Test: test, t: t}
+}
+
+// record evaluates the recording rules at every step from the start until the end,
+// inclusive. Series that a rule stops producing are marked stale, as Prometheus would.
+func (r *ruleTest) record(rules []rulefmt.Rule, start, end time.Time, step time.Duration) {
+	previous := make([]map[string]labels.Labels, len(rules))
+	for ts := start; !ts.After(end); ts = ts.Add(step) {
+		for idx, rule := range rules {
+			if rule.Record == "" {
+				continue
+			}
+
+			appender, err := r.Storage().Appender()
+			if err != nil {
+				r.t.Fatalf("failed to append: %v", err)
+			}
+
+			current := map[string]labels.Labels{}
+			for _, sample := range r.query(rule.Expr, ts) {
+				builder := labels.NewBuilder(sample.Metric)
+				builder.Set(labels.MetricName, rule.Record)
+				for name, value := range rule.Labels {
+					builder.Set(name, value)
+				}
+
+				series := builder.Labels()
+				current[series.String()] = series
+				if _, err := appender.Add(series, timestamp.FromTime(ts), sample.V); err != nil {
+					r.t.Fatalf("failed to append %s: %v", rule.Record, err)
+				}
+			}
+
+			for key, series := range previous[idx] {
+				if _, ok := current[key]; !ok {
+					if _, err := appender.Add(series, timestamp.FromTime(ts), math.Float64frombits(value.StaleNaN)); err != nil {
+						r.t.Fatalf("failed to mark %s stale: %v", rule.Record, err)
+					}
+				}
+			}
+
+			previous[idx] = current
+			if err := appender.Commit(); err != nil {
+				r.t.Fatalf("failed to commit %s: %v", rule.Record, err)
+			}
+		}
+	}
+}
+
+// query evaluates an instant query, returning scalars as a vector of a single sample
+func (r *ruleTest) query(expr string, ts time.Time) promql.Vector {
+	query, err := r.QueryEngine().NewInstantQuery(r.Queryable(), expr, ts)
+	if err != nil {
+		r.t.Fatalf("invalid query %s: %v", expr, err)
+	}
+
+	result := query.Exec(r.Context())
+	if result.Err != nil {
+		r.t.Fatalf("failed to evaluate %s: %v", expr, result.Err)
+	}
+
+	switch value := result.Value.(type) {
+	case promql.Vector:
+		return value
+	case promql.Scalar:
+		return promql.Vector{promql.Sample{Point: promql.Point{T: value.T, V: value.V}}}
+	}
+
+	r.t.Fatalf("unexpected result of %s: %v", expr, result.Value)
+	return nil
+}
+
+// value evaluates a query expected to produce a single sample, reporting whether it did
+func (r *ruleTest) value(expr string, ts time.Time) (float64, bool) {
+	vector := r.query(expr, ts)
+	if len(vector) > 1 {
+		r.t.Fatalf("expected %s to produce a single sample, but got %v", expr, vector)
+	}
+
+	if len(vector) == 0 {
+		return 0, false
+	}
+
+	return vector[0].V, true
+}
+
+// assertValue checks that a query produces a single sample with the expected value
+func (r *ruleTest) assertValue(expr string, ts time.Time, expected float64) {
+	r.t.Helper()
+
+	got, ok := r.value(expr, ts)
+	if !ok {
+		r.t.Errorf("expected %s to be %v at %s, but it was absent", expr, expected, ts.UTC().Format(time.RFC3339))
+		return
+	}
+
+	if math.Abs(got-expected) > 1e-9 && !(math.IsInf(got, 1) && math.IsInf(expected, 1)) {
+		r.t.Errorf("expected %s to be %v at %s, but got %v", expr, expected, ts.UTC().Format(time.RFC3339), got)
+	}
+}
+
+// assertAbsent checks that a query produces no samples
+func (r *ruleTest) assertAbsent(expr string, ts time.Time) {
+	r.t.Helper()
+
+	if got, ok := r.value(expr, ts); ok {
+		r.t.Errorf("expected %s to be absent at %s, but got %v", expr, ts.UTC().Format(time.RFC3339), got)
+	}
+}
+
+// minute is the time the given number of minutes after the series loaded by a ruleTest
+// begin
+func minute(minutes int) time.Time {
+	return time.Unix(int64(minutes*60), 0).UTC()
+}
+
+// evalSLOs loads the series, then records the rules for the SLOs every minute until the
+// given number of minutes have passed
+func evalSLOs(t *testing.T, load string, minutes int, slos ...SLO) *ruleTest {
+	test := newRuleTest(t, load)
+	test.record(pipelineRules(t, slos...), minute(0), minute(minutes), time.Minute)
+
+	return test
+}
+
+// mustParseSLO parses a single definition from its YAML, failing the test if it's invalid
+func mustParseSLO(t *testing.T, template, definition string) SLO {
+	slos, err := ParseDefinitions([]byte("definitions:\n  - template: " + template + "\n    definition:\n" + indent(definition, "      ")))
+	if err != nil {
+		t.Fatalf("invalid %s definition: %v", template, err)
+	}
+
+	return slos[0]
+}
+
+// parseSLOError parses a single definition that is expected to be invalid, returning the
+// error
+func parseSLOError(t *testing.T, template, definition string) error {
+	_, err := ParseDefinitions([]byte("definitions:\n  - template: " + template + "\n    definition:\n" + indent(definition, "      ")))
+	if err == nil {
+		t.Fatalf("expected %s definition to be invalid:\n%s", template, definition)
+	}
+
+	return err
+}
+
+func indent(text, prefix string) string {
+	lines := strings.Split(strings.TrimRight(text, "\n"), "\n")
+	return prefix + strings.Join(lines, "\n"+prefix) + "\n"
+}
+
+// pipelineRules builds the rules for the SLOs as the build command would, without the
+// alerts
+func pipelineRules(t *testing.T, slos ...SLO) []rulefmt.Rule {
+	sorted, err := SortByDependencies(slos)
+	if err != nil {
+		t.Fatalf("failed to sort SLOs: %v", err)
+	}
+
+	p := NewPipeline("test")
+	p.MustRegister(sorted...)
+
+	rules := []rulefmt.Rule{}
+	for _, rule := range p.Build().Groups[0].Rules {
+		if rule.Record != "" {
+			rules = append(rules, rule)
+		}
+	}
+
+	return rules
+}
+
+// TestExampleRules ensures every rule generated from the example definitions is valid
+// PromQL, and that example-rules.yaml has been regenerated since the definitions or
+// templates last changed.
+func TestExampleRules(t *testing.T) {
+	definitions, err := ioutil.ReadFile("../../example-definitions.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	slos, err := ParseDefinitions(definitions)
+	if err != nil {
+		t.Fatalf("invalid example definitions: %v", err)
+	}
+
+	slos, err = SortByDependencies(slos)
+	if err != nil {
+		t.Fatalf("failed to sort example definitions: %v", err)
+	}
+
+	p := NewPipeline("slo-builder")
+	p.MustRegister(slos...)
+
+	groups := p.Build()
+	for _, rule := range groups.Groups[0].Rules {
+		if _, err := promql.ParseExpr(rule.Expr); err != nil {
+			t.Errorf("invalid expression for %s%s: %v\n%s", rule.Record, rule.Alert, err, rule.Expr)
+		}
+	}
+
+	generated, err := yaml.Marshal(groups)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected, err := ioutil.ReadFile("../../example-rules.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(generated) != string(expected) {
+		t.Errorf("example-rules.yaml is out of date, run make example-rules.yaml")
+	}
+}
+
+func TestAlertLabels(t *testing.T) {
+	definition := `
+name: %s
+budget: 0.01
+dimensions: [handler]
+maxSeries: 1
+errors: rate(http_requests_total{app="%s", status="500"}[5m])
+total: rate(http_requests_total{app="%[2]s"}[5m])
+`
+
+	paged := mustParseSLO(t, "ErrorRateSLO", fmt.Sprintf(definition, "Paged", "payments")+"labels: {channel: payments, severity: page}\n")
+	unlabelled := mustParseSLO(t, "ErrorRateSLO", fmt.Sprintf(definition, "Unlabelled", "mandates"))
+
+	// Every request fails, which burns through the budget of every window, and each SLO has
+	// more handlers than its maxSeries
+	test := evalSLOs(t, `
+load 1m
+  http_requests_total{app="payments", handler="search", status="500"} 0+10x30
+  http_requests_total{app="payments", handler="create", status="500"} 0+10x30
+  http_requests_total{app="mandates", handler="search", status="500"} 0+10x30
+  http_requests_total{app="mandates", handler="create", status="500"} 0+10x30
+`, 30, paged, unlabelled)
+	defer test.Close()
+
+	for _, alert := range []string{"SLOErrorBudgetFastBurn", "SLOErrorBudgetSlowBurn", "SLODimensionsOverLimit"} {
+		for _, rule := range AlertRules {
+			if rule.Alert != alert {
+				continue
+			}
+
+			got := map[string]string{}
+			for _, sample := range test.query(rule.Expr, minute(30)) {
+				got[sample.Metric.Get("name")] = fmt.Sprintf("channel=%q severity=%q", sample.Metric.Get("channel"), sample.Metric.Get("severity"))
+			}
+
+			expected := map[string]string{
+				"Paged":      `channel="payments" severity="page"`,
+				"Unlabelled": `channel="" severity="ticket"`,
+			}
+
+			if !reflect.DeepEqual(got, expected) {
+				t.Errorf("%s: expected labels %v, got %v", alert, expected, got)
+			}
+		}
+	}
+}
@@ -0,0 +1,209 @@
+package templates
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/prometheus/prometheus/pkg/rulefmt"
+)
+
+var (
+	// WorkloadAvailabilityTemplateRules map from the job:slo_workload_* time series to the
+	// SLO-compliant job:slo_error:ratio<I> series that are used to power alerts.
+	WorkloadAvailabilityTemplateRules = flattenRules(
+		// Each interval is an error if fewer replicas are available than required
+		rulefmt.Rule{
+			Record: "job:slo_workload_error:interval",
+			Expr:   unlessExcluded(`job:slo_workload_available:count < bool job:slo_workload_required:count`),
+		},
+		// Use avg_over_time to map job:slo_workload_error:interval into error rate as
+		// measured over the common alert window intervals.
+		forIntervals(AlertWindows,
+			rulefmt.Rule{
+				Record: "job:slo_error:ratio%s",
+				Expr:   `avg_over_time(job:slo_workload_error:interval[%s])`,
+			},
+		),
+	)
+)
+
+func init() {
+	MustRegisterTemplate(WorkloadAvailabilitySLO{}, WorkloadAvailabilityTemplateRules...)
+}
+
+// WorkloadAvailabilitySLO is used to construct SLOs on the availability of Kubernetes
+// workloads, such as the payments-api Deployment having at least 3 available replicas
+// 99.9% of the time, using the series produced by kube-state-metrics.
+//
+// To use this template, you provide the kind of workload (Deployment, StatefulSet or
+// DaemonSet), regular expressions matching the namespace and name of the workload, and
+// either the minimum number of replicas that must be available or the minimum fraction
+// of desired replicas. Each interval in which fewer replicas are available is an error.
+//
+// Workloads are sometimes scaled to zero on purpose, in which case they have no replicas
+// available but aren't failing. By default such intervals are excluded from the error
+// ratio, but can instead be scored as good, or as bad if a workload should never be
+// scaled to zero.
+type WorkloadAvailabilitySLO struct {
+	baseSLO
+	Kind              workloadKind       // kind of workload, one of Deployment, StatefulSet or DaemonSet
+	Namespace         string             // regex matching the namespace of the workload
+	Workload          string             // regex matching the name of the workload
+	MinAvailable      int                // minimum number of replicas that must be available
+	MinAvailableRatio float64            // minimum fraction of desired replicas that must be available
+	ScaledToZero      scaledToZeroPolicy // how to score intervals where the workload is scaled to zero
+}
+
+func (w WorkloadAvailabilitySLO) Validate() error {
+	if _, ok := workloadMetrics[w.Kind]; !ok {
+		return fmt.Errorf("kind must be provided")
+	}
+
+	if w.Namespace == "" || w.Workload == "" {
+		return fmt.Errorf("namespace and workload must be provided")
+	}
+
+	if (w.MinAvailable > 0) == (w.MinAvailableRatio > 0) {
+		return fmt.Errorf("exactly one of minAvailable or minAvailableRatio must be provided")
+	}
+
+	if w.MinAvailable < 0 || w.MinAvailableRatio < 0 || w.MinAvailableRatio > 1 {
+		return fmt.Errorf("minAvailable must be positive, and minAvailableRatio between 0 and 1")
+	}
+
+	if err := w.validateExprs(w.selector(workloadMetrics[w.Kind].available)); err != nil {
+		return err
+	}
+
+	return w.validateDimensions("max", w.selector(workloadMetrics[w.Kind].available))
+}
+
+func (w WorkloadAvailabilitySLO) Rules() []rulefmt.Rule {
+	metrics := workloadMetrics[w.Kind]
+	desired := fmt.Sprintf(`job:slo_workload_desired:count{name="%s"}`, w.Name)
+
+	definition := map[string]string{
+		"template":       "WorkloadAvailabilitySLO",
+		"kind":           string(w.Kind),
+		"namespace":      w.Namespace,
+		"workload":       w.Workload,
+		"scaled_to_zero": w.ScaledToZero.String(),
+	}
+
+	required := fmt.Sprintf("0 * %s + %d", desired, w.MinAvailable)
+	if w.MinAvailableRatio > 0 {
+		definition["min_available_ratio"] = strconv.FormatFloat(w.MinAvailableRatio, 'f', -1, 64)
+		required = fmt.Sprintf("ceil(%s * %s)", desired, definition["min_available_ratio"])
+	} else {
+		definition["min_available"] = strconv.Itoa(w.MinAvailable)
+	}
+
+	required = fmt.Sprintf("(%s unless %s == 0)", required, desired)
+	switch w.ScaledToZero {
+	case scaledToZeroGood:
+		required = fmt.Sprintf("%s\nor\n(%s == 0)", required, desired)
+	case scaledToZeroBad:
+		required = fmt.Sprintf("%s\nor\n(%s == 0) + 1", required, desired)
+	}
+
+	return flattenRules(
+		w.baseSLO.Rules(definition),
+		w.dimensionRules("max", w.mustRender(w.selector(metrics.desired))),
+		rulefmt.Rule{
+			Record: "job:slo_workload_available:count",
+			Labels: w.joinLabels(),
+			Expr:   w.mustAggregate("max", w.mustRender(w.selector(metrics.available))),
+		},
+		rulefmt.Rule{
+			Record: "job:slo_workload_desired:count",
+			Labels: w.joinLabels(),
+			Expr:   w.mustAggregate("max", w.mustRender(w.selector(metrics.desired))),
+		},
+		rulefmt.Rule{
+			Record: "job:slo_workload_required:count",
+			Labels: w.joinLabels(),
+			Expr:   required,
+		},
+	)
+}
+
+// selector finds the given kube-state-metrics series for the workload, aggregating away
+// any labels that describe the kube-state-metrics instance rather than the workload. SLOs
+// with dimensions are aggregated by them instead.
+func (w WorkloadAvailabilitySLO) selector(metric string) string {
+	label := workloadMetrics[w.Kind].label
+	selector := fmt.Sprintf(
+		`%s{namespace=~%s, %s=~%s}`, metric, strconv.Quote(w.Namespace), label, strconv.Quote(w.Workload),
+	)
+
+	if len(w.Dimensions) > 0 {
+		return selector
+	}
+
+	return fmt.Sprintf(`max by (namespace, %s) (%s)`, label, selector)
+}
+
+// workloadKind is the kind of Kubernetes workload, as it appears in the kube-state-metrics
+// series names and labels
+type workloadKind string
+
+var workloadMetrics = map[workloadKind]struct {
+	label     string // label containing the workload name
+	available string // number of replicas currently available
+	desired   string // number of replicas the workload should have
+}{
+	"Deployment":  {"deployment", "kube_deployment_status_replicas_available", "kube_deployment_spec_replicas"},
+	"StatefulSet": {"statefulset", "kube_statefulset_status_replicas_ready", "kube_statefulset_replicas"},
+	"DaemonSet":   {"daemonset", "kube_daemonset_status_number_available", "kube_daemonset_status_desired_number_scheduled"},
+}
+
+func (k *workloadKind) UnmarshalJSON(payload []byte) error {
+	var human string
+	if err := json.Unmarshal(payload, &human); err != nil {
+		return err
+	}
+
+	if _, ok := workloadMetrics[workloadKind(human)]; !ok {
+		return fmt.Errorf("invalid workload kind %q, expected one of: Deployment, StatefulSet, DaemonSet", human)
+	}
+
+	*k = workloadKind(human)
+	return nil
+}
+
+// scaledToZeroPolicy decides how intervals are scored where a workload has been scaled to
+// zero desired replicas
+type scaledToZeroPolicy string
+
+const (
+	scaledToZeroExcluded scaledToZeroPolicy = "excluded" // intervals don't contribute to the error rate
+	scaledToZeroGood     scaledToZeroPolicy = "good"     // intervals are scored as good
+	scaledToZeroBad      scaledToZeroPolicy = "bad"      // intervals are scored as bad
+)
+
+func (p *scaledToZeroPolicy) UnmarshalJSON(payload []byte) error {
+	var human string
+	if err := json.Unmarshal(payload, &human); err != nil {
+		return err
+	}
+
+	switch policy := scaledToZeroPolicy(human); policy {
+	case scaledToZeroExcluded, scaledToZeroGood, scaledToZeroBad:
+		*p = policy
+		return nil
+	}
+
+	return fmt.Errorf(
+		"invalid scaledToZero policy %q, expected one of: %s, %s, %s",
+		human, scaledToZeroExcluded, scaledToZeroGood, scaledToZeroBad,
+	)
+}
+
+func (p scaledToZeroPolicy) String() string {
+	if p == "" {
+		return string(scaledToZeroExcluded)
+	}
+
+	return string(p)
+}
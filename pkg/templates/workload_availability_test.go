@@ -0,0 +1,55 @@
+package templates
+
+import (
+	"testing"
+)
+
+func TestWorkloadAvailabilitySLO(t *testing.T) {
+	excluded := mustParseSLO(t, "WorkloadAvailabilitySLO", `
+name: Excluded
+budget: 0.01
+kind: Deployment
+namespace: payments
+workload: api
+minAvailable: 3
+`)
+
+	bad := mustParseSLO(t, "WorkloadAvailabilitySLO", `
+name: Bad
+budget: 0.01
+kind: Deployment
+namespace: payments
+workload: api
+minAvailableRatio: 0.5
+scaledToZero: bad
+`)
+
+	test := evalSLOs(t, `
+load 1m
+  kube_deployment_status_replicas_available{namespace="payments", deployment="api"} 3 2 0 1
+  kube_deployment_spec_replicas{namespace="payments", deployment="api"} 3 3 0 3
+`, 3, excluded, bad)
+	defer test.Close()
+
+	test.assertValue(`job:slo_workload_error:interval{name="Excluded"}`, minute(0), 0)
+	test.assertValue(`job:slo_workload_error:interval{name="Excluded"}`, minute(1), 1)
+	test.assertAbsent(`job:slo_workload_error:interval{name="Excluded"}`, minute(2))
+	test.assertValue(`job:slo_workload_error:interval{name="Excluded"}`, minute(3), 1)
+
+	// Half of 3 replicas rounds up to 2 required
+	test.assertValue(`job:slo_workload_error:interval{name="Bad"}`, minute(1), 0)
+	test.assertValue(`job:slo_workload_error:interval{name="Bad"}`, minute(2), 1)
+	test.assertValue(`job:slo_workload_error:interval{name="Bad"}`, minute(3), 1)
+}
+
+func TestWorkloadAvailabilitySLOValidate(t *testing.T) {
+	parseSLOError(t, "WorkloadAvailabilitySLO", `
+name: API
+budget: 0.01
+kind: Deployment
+namespace: payments
+workload: api
+minAvailable: 3
+minAvailableRatio: 0.5
+`)
+}